@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/appliedgo/flow2go/internal/benchnet"
+)
+
+// `benchNet` wires a network like `main()`, but with any power of two of
+// counters: a tree of splitters fans the input out to the counters, which
+// alternate between words and letters, and every two counters share a
+// printer.
+func benchNet(counters, capacity int) (chan<- string, []chan struct{}) {
+	in := make(chan string, capacity)
+	sentences := []<-chan string{in}
+	for len(sentences) < counters {
+		var next []<-chan string
+		for _, ch := range sentences {
+			out1 := make(chan string, capacity)
+			out2 := make(chan string, capacity)
+			(&splitter{In: ch, Out1: out1, Out2: out2}).Process()
+			next = append(next, out1, out2)
+		}
+		sentences = next
+	}
+
+	var dones []chan struct{}
+	for i := 0; i < counters; i += 2 {
+		wcToP := make(chan *count, capacity)
+		lcToP := make(chan *count, capacity)
+		done := make(chan struct{})
+		(&wordCounter{Sentence: sentences[i], Count: wcToP}).Process()
+		(&letterCounter{Sentence: sentences[i+1], Count: lcToP}).Process()
+		(&printer{Line1: wcToP, Line2: lcToP, Done: done}).Process()
+		dones = append(dones, done)
+	}
+	return in, dones
+}
+
+func BenchmarkNetwork(b *testing.B) {
+	benchnet.Run(b, func(counters, capacity int) (chan<- string, func()) {
+		in, dones := benchNet(counters, capacity)
+		return in, func() {
+			for _, done := range dones {
+				<-done
+			}
+		}
+	})
+}
@@ -0,0 +1,543 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/appliedgo/flow2go/internal/benchnet"
+	"github.com/appliedgo/flow2go/internal/graph"
+)
+
+// This file is the command line interface of the `flow2go` binary:
+//
+//	go build && ./flow2go run -i texts/ counternet.fbp
+//
+// Without arguments, the binary runs the demo in `main()`, as does
+// `go run flow2go.go`, which does not compile this file. That's why `main()`
+// reaches the subcommands through the `commandLine` hook, which this file
+// sets.
+
+// The exit codes of the command line interface.
+const (
+	exitOK = 0
+	// The network failed: input or output errors, or nodes that did not
+	// shut down.
+	exitFailure = 1
+	// Unknown subcommands or flags.
+	exitUsage = 2
+	// The graph cannot be loaded or is invalid.
+	exitInvalid = 3
+)
+
+// A `command` is a subcommand. `run` gets the arguments after the name of
+// the subcommand and returns the exit code.
+type command struct {
+	name, args, doc string
+	run             func(c *cli, args []string) int
+}
+
+var commands = []command{
+	{"run", "[-i path]... [-o file] [-format text|jsonl|csv|table] [-segment] <graph>",
+		"runs a network, feeding it lines from files, directories, or stdin", (*cli).run},
+	{"validate", "<graph>", "checks a graph against the components", (*cli).validate},
+	{"graph", "[-format dot|mermaid] <graph>", "draws a graph", (*cli).graph},
+	{"components", "", "lists the components that graphs can use", (*cli).components},
+	{"bench", "[-n sentences] [-capacity n] [-benchtime d] <graph>", "measures the throughput of a network", (*cli).bench},
+	{"repl", "[-capacity n] [-taps address] <graph>", "runs a network on sentences typed on the terminal", (*cli).repl},
+}
+
+func init() {
+	commandLine = run
+}
+
+// `run` runs the subcommand in `args` on the standard streams and returns
+// the exit code.
+func run(args []string) int {
+	return (&cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}).main(args)
+}
+
+// `cli` holds where the subcommands read from and write to.
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+func (c *cli) main(args []string) int {
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		c.usage(c.stdout)
+		return exitOK
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(c, args[1:])
+		}
+	}
+	fmt.Fprintf(c.stderr, "flow2go: unknown command %q\n", args[0])
+	c.usage(c.stderr)
+	return exitUsage
+}
+
+func (c *cli) usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintln(w, "  flow2go                  runs the demo")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  flow2go %s %s\n        %s\n", cmd.name, cmd.args, cmd.doc)
+	}
+	fmt.Fprintf(w, "Exit codes: %d on success, %d if the network fails, %d for usage errors, %d for invalid graphs.\n",
+		exitOK, exitFailure, exitUsage, exitInvalid)
+}
+
+func (c *cli) errorf(code int, format string, args ...interface{}) int {
+	fmt.Fprintf(c.stderr, "flow2go: "+format+"\n", args...)
+	return code
+}
+
+// `parse` parses the flags of a subcommand, which may come before or after
+// the positional arguments, and checks that there are `n` positional
+// arguments. It returns the positional arguments, or an exit code.
+func (c *cli) parse(fs *flag.FlagSet, args []string, n int) ([]string, int) {
+	fs.SetOutput(c.stderr)
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, exitOK
+			}
+			return nil, exitUsage
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		pos = append(pos, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(pos) != n {
+		return nil, c.errorf(exitUsage, "%s: want %d argument(s), got %d", fs.Name(), n, len(pos))
+	}
+	return pos, -1
+}
+
+// `load` loads and plans a graph, and warns about unconnected ports.
+func (c *cli) load(path string, capacity int) (*graph.Graph, *graphPlan, int) {
+	if capacity < 1 {
+		return nil, nil, c.errorf(exitUsage, "-capacity %d: edges need a capacity of at least 1", capacity)
+	}
+	g, err := graph.Load(path)
+	if err != nil {
+		return nil, nil, c.errorf(exitInvalid, "%v", err)
+	}
+	pl, err := planGraph(g, capacity)
+	if err != nil {
+		return nil, nil, c.errorf(exitInvalid, "%s: %v", path, err)
+	}
+	for _, p := range pl.Unconnected {
+		fmt.Fprintf(c.stderr, "flow2go: warning: %s: %s is not connected\n", path, p)
+	}
+	return g, pl, -1
+}
+
+// `paths` is a flag that can be given more than once.
+type paths []string
+
+func (p *paths) String() string     { return strings.Join(*p, ",") }
+func (p *paths) Set(s string) error { *p = append(*p, s); return nil }
+
+func (c *cli) run(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	var inputs paths
+	fs.Var(&inputs, "i", "read lines from a file, glob pattern, directory, or `-` for stdin (repeatable; default stdin)")
+	output := fs.String("o", "", "write the output to `file` rather than stdout")
+	format := fs.String("format", "text", "output `format` of counts: text, jsonl, csv, or table; all but text need an outport for counts")
+	segment := fs.Bool("segment", false, "split the input into sentences, rather than treating each line as one")
+	capacity := fs.Int("capacity", 10, "capacity of the edges")
+	timeout := fs.Duration("timeout", time.Second, "how long to wait for the nodes to exit after the output is complete")
+	pos, code := c.parse(fs, args, 1)
+	if code >= 0 {
+		return code
+	}
+	opts := runOptions{capacity: *capacity, format: *format, timeout: *timeout}
+	if *format != "text" {
+		f, err := parseSinkFormat(*format)
+		if err != nil {
+			return c.errorf(exitUsage, "%v", err)
+		}
+		opts.sinkFormat = f
+	}
+	if len(inputs) == 0 {
+		inputs = paths{"-"}
+	}
+	_, pl, code := c.load(pos[0], *capacity)
+	if code >= 0 {
+		return code
+	}
+	if _, err := pl.sentenceInport(); err != nil {
+		return c.errorf(exitInvalid, "%s: %v", pos[0], err)
+	}
+	if *format != "text" && !pl.countOutport() {
+		return c.errorf(exitUsage, "-format %s: %s has no outport for counts, so there is nothing to write", *format, pos[0])
+	}
+
+	// The nodes print to stdout. In text format, that's part of the output,
+	// so -o redirects it, too. Structured output must stay parseable, so
+	// there, what the nodes print goes to stderr.
+	opts.w = c.stdout
+	nodeOutput := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return c.errorf(exitFailure, "%v", err)
+		}
+		defer f.Close()
+		opts.w, nodeOutput = f, f
+	}
+	if *format != "text" {
+		nodeOutput = os.Stderr
+	}
+	orig := os.Stdout
+	os.Stdout = nodeOutput
+	defer func() { os.Stdout = orig }()
+
+	var mu sync.Mutex
+	var inputErrs []error
+	err := execute(pl, opts, func(in chan<- string) {
+		src := &fileSource{Paths: inputs, OnError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			inputErrs = append(inputErrs, err)
+		}}
+		if !*segment {
+			src.Out = in
+			src.Process()
+			return
+		}
+		lines := make(chan string, *capacity)
+		src.Out = lines
+		src.Process()
+		(&segmenter{In: lines, Out: in}).Process()
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	for _, e := range inputErrs {
+		fmt.Fprintf(c.stderr, "flow2go: %v\n", e)
+	}
+	if err != nil {
+		return c.errorf(exitFailure, "%v", err)
+	}
+	if len(inputErrs) > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+func (c *cli) validate(args []string) int {
+	pos, code := c.parse(flag.NewFlagSet("validate", flag.ContinueOnError), args, 1)
+	if code >= 0 {
+		return code
+	}
+	// Validating builds no edges, so any capacity will do.
+	_, pl, code := c.load(pos[0], 1)
+	if code >= 0 {
+		return code
+	}
+	fmt.Fprintf(c.stdout, "%s: %d processes, %d edges, %d inports, %d outports\n",
+		pos[0], len(pl.order), len(pl.wires)-len(pl.inports)-len(pl.outports), len(pl.inports), len(pl.outports))
+	return exitOK
+}
+
+func (c *cli) graph(args []string) int {
+	fs := flag.NewFlagSet("graph", flag.ContinueOnError)
+	format := fs.String("format", graph.FormatDot, "diagram `format`: dot or mermaid")
+	pos, code := c.parse(fs, args, 1)
+	if code >= 0 {
+		return code
+	}
+	g, err := graph.Load(pos[0])
+	if err == nil {
+		err = g.Validate()
+	}
+	if err != nil {
+		return c.errorf(exitInvalid, "%v", err)
+	}
+	if err := g.Render(c.stdout, *format); err != nil {
+		return c.errorf(exitUsage, "%v", err)
+	}
+	return exitOK
+}
+
+func (c *cli) components(args []string) int {
+	if _, code := c.parse(flag.NewFlagSet("components", flag.ContinueOnError), args, 0); code >= 0 {
+		return code
+	}
+	tw := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COMPONENT\tINPUTS\tOUTPUTS\tDESCRIPTION")
+	for _, comp := range components() {
+		in, out := portNames(comp.New())
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", comp.Name, strings.Join(in, ", "), strings.Join(out, ", "), comp.Doc)
+	}
+	tw.Flush()
+	return exitOK
+}
+
+// `portNames` returns the names of a node's input and output ports.
+func portNames(node processor) (in, out []string) {
+	t := reflect.TypeOf(node).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		typ, name := f.Type, f.Name
+		if typ.Kind() == reflect.Map && typ.Elem().Kind() == reflect.Chan {
+			typ, name = typ.Elem(), name+"[...]"
+		}
+		if !f.IsExported() || typ.Kind() != reflect.Chan {
+			continue
+		}
+		if typ.ChanDir() == reflect.RecvDir {
+			in = append(in, name)
+		} else {
+			out = append(out, name)
+		}
+	}
+	return in, out
+}
+
+func (c *cli) bench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	n := fs.Int("n", 1000, "number of sentences per run")
+	capacity := fs.Int("capacity", 10, "capacity of the edges")
+	benchtime := fs.Duration("benchtime", time.Second, "how long to run the network again and again")
+	pos, code := c.parse(fs, args, 1)
+	if code >= 0 {
+		return code
+	}
+	g, pl, code := c.load(pos[0], *capacity)
+	if code >= 0 {
+		return code
+	}
+	if _, err := pl.sentenceInport(); err != nil {
+		return c.errorf(exitInvalid, "%s: %v", pos[0], err)
+	}
+
+	devnull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return c.errorf(exitFailure, "%v", err)
+	}
+	defer devnull.Close()
+	orig := os.Stdout
+	os.Stdout = devnull
+	defer func() { os.Stdout = orig }()
+
+	input := benchnet.Input(*n)
+	// Like `go test -bench`, run the network again and again until the
+	// measured time is up, and count the allocations of all runs. The clock
+	// runs from the first sentence until all outports are closed; planning,
+	// building, and starting the network count as setup, and waiting for
+	// the nodes to exit does not count at all.
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	var elapsed, setup time.Duration
+	runs := 0
+	for runs == 0 || elapsed < *benchtime {
+		setupStart := time.Now()
+		// Every run needs fresh nodes; the first plan has been checked
+		// already.
+		if runs > 0 {
+			pl, _ = planGraph(g, *capacity)
+		}
+		var start time.Time
+		opts := runOptions{w: io.Discard, timeout: time.Second, drained: func() {
+			elapsed += time.Since(start)
+		}}
+		err := execute(pl, opts, func(in chan<- string) {
+			start = time.Now()
+			setup += start.Sub(setupStart)
+			go func() {
+				for _, s := range input {
+					in <- s
+				}
+				close(in)
+			}()
+		})
+		if err != nil {
+			return c.errorf(exitFailure, "%v", err)
+		}
+		runs++
+	}
+	runtime.ReadMemStats(&after)
+
+	perSentence := float64(elapsed.Nanoseconds()) / float64(runs) / float64(*n)
+	fmt.Fprintf(c.stdout, "%s: %d runs of %d sentences with capacity %d\n", pos[0], runs, *n, *capacity)
+	fmt.Fprintf(c.stdout, "%12.0f sentences/s\n%12.0f ns/sentence\n%12d ns/run setup\n%12d allocs/run, with setup\n%12d B/run, with setup\n",
+		1e9/perSentence, perSentence, setup.Nanoseconds()/int64(runs),
+		(after.Mallocs-before.Mallocs)/uint64(runs), (after.TotalAlloc-before.TotalAlloc)/uint64(runs))
+	return exitOK
+}
+
+// `runOptions` configure `execute`.
+type runOptions struct {
+	capacity int
+	// Where the packets from the outports go. With `format` "text", each
+	// packet is printed on a line of its own; otherwise, counts are written
+	// by a `countWriter` in `sinkFormat`.
+	w          io.Writer
+	format     string
+	sinkFormat sinkFormat
+	timeout    time.Duration
+	// `drained`, if set, is called when all outports are closed and their
+	// packets are written, before waiting for the nodes to exit.
+	drained func()
+}
+
+// `sentenceInport` returns the first inport that accepts sentences.
+func (pl *graphPlan) sentenceInport() (string, error) {
+	for _, w := range pl.wires {
+		if !w.tgt.IsValid() || w.src.IsValid() {
+			continue
+		}
+		if w.elem == reflect.TypeOf("") {
+			return w.name, nil
+		}
+	}
+	return "", fmt.Errorf("the graph has no inport for sentences")
+}
+
+// `countOutport` reports whether an outport of the network sends counts,
+// which is what the formats other than text write.
+func (pl *graphPlan) countOutport() bool {
+	for _, w := range pl.wires {
+		if !w.tgt.IsValid() && w.src.IsValid() && w.elem == reflect.TypeOf(&count{}) {
+			return true
+		}
+	}
+	return false
+}
+
+// `execute` builds and runs the network of `pl`. It calls `start` to start a
+// source that sends the sentences into the network and closes `in` at the
+// end. `execute` returns when all outports are closed and all nodes have
+// exited.
+func execute(pl *graphPlan, opts runOptions, start func(in chan<- string)) error {
+	_, in, wait, err := launch(pl, opts)
+	if err != nil {
+		return err
+	}
+	start(in)
+	return wait()
+}
+
+// `launch` builds and starts the network of `pl`, and starts writing what
+// comes out of the outports to `opts.w`. It returns the network's input for
+// sentences; the other inports of the network are closed right away. After
+// `in` is closed, `wait` waits until all outports are closed and all nodes
+// have exited.
+func launch(pl *graphPlan, opts runOptions) (gn *graphNet, in chan<- string, wait func() error, err error) {
+	inport, err := pl.sentenceInport()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	gn = pl.build()
+	w := &syncWriter{w: opts.w}
+
+	var wg sync.WaitGroup
+	var counts []<-chan *count
+	for _, name := range pl.outports {
+		out := gn.Outports[name]
+		if c, ok := out.Interface().(<-chan *count); ok && opts.format != "text" && opts.format != "" {
+			counts = append(counts, c)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				v, ok := out.Recv()
+				if !ok {
+					return
+				}
+				switch p := v.Interface().(type) {
+				case struct{}:
+				case *count:
+					fmt.Fprintf(w, "%s: %s\n", p.tag, p.value())
+				default:
+					fmt.Fprintln(w, p)
+				}
+			}
+		}()
+	}
+	var writeErr error
+	if len(counts) > 0 {
+		merged := make(chan *count)
+		none := make(chan *count)
+		close(none)
+		done := make(chan struct{})
+		(&countWriter{Line1: merged, Line2: none, Done: done, W: w, Format: opts.sinkFormat,
+			OnError: func(err error) { writeErr = err }}).Process()
+		var merging sync.WaitGroup
+		for _, c := range counts {
+			merging.Add(1)
+			go func(c <-chan *count) {
+				defer merging.Done()
+				for p := range c {
+					merged <- p
+				}
+			}(c)
+		}
+		go func() {
+			merging.Wait()
+			close(merged)
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-done
+		}()
+	}
+
+	gn.start()
+	for name, in := range gn.Inports {
+		if name != inport {
+			in.Close()
+		}
+	}
+	wait = func() error {
+		wg.Wait()
+		if opts.drained != nil {
+			opts.drained()
+		}
+		if writeErr != nil {
+			return writeErr
+		}
+		if err := w.err; err != nil {
+			return err
+		}
+		return gn.Wait(opts.timeout)
+	}
+	return gn, gn.Inports[inport].Interface().(chan<- string), wait, nil
+}
+
+// `syncWriter` lets the outports write to the same writer concurrently, and
+// keeps the first error.
+type syncWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, err := s.w.Write(p)
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	return n, err
+}
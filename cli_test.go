@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// `runCLI` runs the command line interface and returns its exit code and
+// output.
+func runCLI(t *testing.T, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	code = (&cli{stdout: &out, stderr: &errOut}).main(args)
+	return code, out.String(), errOut.String()
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const countsFBP = `INPORT=s.In:In
+OUTPORT=wc.Count:Words
+OUTPORT=lc.Count:Letters
+s(splitter) Out1 -> Sentence wc(wordCounter)
+s Out2 -> Sentence lc(letterCounter)
+`
+
+func TestCLIErrors(t *testing.T) {
+	mismatch := writeFile(t, "mismatch.fbp", "s(splitter) Out1 -> Line1 p(printer)\n")
+	unknown := writeFile(t, "unknown.fbp", "s(splitter) Out1 -> In x(nosuchnode)\n")
+	noInput := writeFile(t, "noinput.fbp", "INPORT=p.Line1:Counts\nOUTPORT=p.Done:Done\nwc(wordCounter) Count -> Line2 p(printer)\n")
+	tests := []struct {
+		args []string
+		code int
+		msg  string
+	}{
+		{[]string{"nosuchcommand"}, exitUsage, "unknown command"},
+		{[]string{"validate"}, exitUsage, "want 1 argument"},
+		{[]string{"validate", "-x", "counternet.fbp"}, exitUsage, "not defined"},
+		{[]string{"validate", "missing.fbp"}, exitInvalid, "missing.fbp"},
+		{[]string{"validate", mismatch}, exitInvalid, "s.Out1 sends string, but p.Line1 receives *main.count"},
+		{[]string{"validate", unknown}, exitInvalid, "unknown component nosuchnode"},
+		{[]string{"run", noInput}, exitInvalid, "no inport for sentences"},
+		{[]string{"run", "-format", "xml", "counternet.fbp"}, exitUsage, "unknown output format"},
+		{[]string{"run", "-capacity", "0", "counternet.fbp"}, exitUsage, "capacity of at least 1"},
+		{[]string{"run", "-i", "missing.txt", "counternet.fbp", "-o", filepath.Join(t.TempDir(), "out.txt")}, exitFailure, "missing.txt"},
+		{[]string{"graph", "counternet.fbp", "-format", "svg"}, exitUsage, "unknown diagram format"},
+	}
+	for _, tt := range tests {
+		code, _, stderr := runCLI(t, tt.args...)
+		if code != tt.code || !strings.Contains(stderr, tt.msg) {
+			t.Errorf("%q: got exit code %d and %q, want %d and %q", tt.args, code, stderr, tt.code, tt.msg)
+		}
+	}
+}
+
+func TestCLIValidate(t *testing.T) {
+	code, stdout, stderr := runCLI(t, "validate", "counternet.fbp")
+	if code != exitOK || stdout != "counternet.fbp: 4 processes, 4 edges, 1 inports, 1 outports\n" || stderr != "" {
+		t.Errorf("got %d, %q, %q", code, stdout, stderr)
+	}
+	code, _, stderr = runCLI(t, "validate", writeFile(t, "partial.fbp", "s(splitter) Out1 -> Sentence wc(wordCounter)\n"))
+	if code != exitOK || !strings.Contains(stderr, "warning") || !strings.Contains(stderr, "s.In is not connected") {
+		t.Errorf("got %d, %q, want warnings for unconnected ports", code, stderr)
+	}
+}
+
+func TestCLIGraph(t *testing.T) {
+	for format, want := range map[string]string{"dot": "digraph {", "mermaid": "flowchart LR"} {
+		code, stdout, _ := runCLI(t, "graph", "--format", format, "counternet.fbp")
+		if code != exitOK || !strings.HasPrefix(stdout, want) {
+			t.Errorf("%s: got %d, %q", format, code, stdout)
+		}
+	}
+}
+
+func TestCLIComponents(t *testing.T) {
+	code, stdout, _ := runCLI(t, "components")
+	if code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	if len(strings.Split(strings.TrimSpace(stdout), "\n")) != len(registry)+1 {
+		t.Errorf("want a header and a line per component, got\n%s", stdout)
+	}
+	if !strings.Contains(stdout, "router ") || !strings.Contains(stdout, "Out[...], Default") {
+		t.Errorf("router is missing or has the wrong ports:\n%s", stdout)
+	}
+}
+
+func TestCLIRun(t *testing.T) {
+	input := writeFile(t, "input.txt", "Why? Because.\nLife is too\nimportant.\n")
+	graph := writeFile(t, "counts.fbp", countsFBP)
+
+	t.Run("text", func(t *testing.T) {
+		out := filepath.Join(t.TempDir(), "out.txt")
+		code, _, stderr := runCLI(t, "run", "-i", input, "-o", out, "counternet.fbp")
+		if code != exitOK {
+			t.Fatalf("exit code %d: %s", code, stderr)
+		}
+		b, _ := os.ReadFile(out)
+		for _, want := range []string{"Words: 2\n", "Letters: 9\n", "Printer has finished.\n"} {
+			if !strings.Contains(string(b), want) {
+				t.Errorf("output lacks %q:\n%s", want, b)
+			}
+		}
+	})
+
+	// counternet.fbp sends its counts to its printer, so only text has
+	// something to write.
+	for _, format := range []string{"text", "jsonl", "csv", "table"} {
+		t.Run("counternet.fbp as "+format, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "out.txt")
+			code, _, stderr := runCLI(t, "run", "-format", format, "-i", input, "-o", out, "counternet.fbp")
+			b, _ := os.ReadFile(out)
+			if format == "text" {
+				if code != exitOK || !strings.Contains(string(b), "Words: 2\n") {
+					t.Errorf("exit code %d, output:\n%s%s", code, b, stderr)
+				}
+				return
+			}
+			if code != exitUsage || !strings.Contains(stderr, "no outport for counts") {
+				t.Errorf("got exit code %d and %q, want a usage error", code, stderr)
+			}
+		})
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		// What the nodes print goes to stderr.
+		devnull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer devnull.Close()
+		orig := os.Stderr
+		os.Stderr = devnull
+		code, stdout, stderr := runCLI(t, "run", "-segment", "-format", "csv", "-i", input, graph)
+		os.Stderr = orig
+		if code != exitOK {
+			t.Fatalf("exit code %d: %s", code, stderr)
+		}
+		lines := strings.Split(strings.TrimSpace(stdout), "\n")
+		sort.Strings(lines[1:])
+		want := []string{"tag,count", "Letters,18", "Letters,3", "Letters,7", "Words,1", "Words,1", "Words,4"}
+		if strings.Join(lines, " ") != strings.Join(want, " ") {
+			t.Errorf("got %q, want %q", lines, want)
+		}
+	})
+}
+
+func TestCLIBench(t *testing.T) {
+	// A zero benchtime still measures one run.
+	code, stdout, stderr := runCLI(t, "bench", "-n", "10", "-benchtime", "0", "counternet.fbp")
+	if code != exitOK || !strings.Contains(stdout, ": 1 runs of 10 sentences") || !strings.Contains(stdout, "sentences/s") || !strings.Contains(stdout, "ns/run setup") {
+		t.Errorf("got %d, %q, %q", code, stdout, stderr)
+	}
+}
+
+func TestCLIREPL(t *testing.T) {
+	graph := writeFile(t, "counts.fbp", countsFBP)
+	stdin := strings.Join([]string{
+		"The quick brown fox.",
+		":stats",
+		":tap Words",
+		"One two three.",
+		":graph",
+		":tap nosuchedge",
+		":frobnicate",
+		"::colon",
+		":quit",
+		"After quitting.",
+	}, "\n")
+	var out, errOut bytes.Buffer
+	code := (&cli{stdin: strings.NewReader(stdin), stdout: &out, stderr: &errOut}).main([]string{"repl", graph})
+	if code != exitOK {
+		t.Fatalf("exit code %d: %s", code, errOut.String())
+	}
+	for _, want := range []string{
+		"Words: 4\n", "Letters: 16\n",
+		"Words: 3\n", "[Words] Words: 3\n",
+		"Words: 1\n", "Letters: 5\n",
+		"blocked", "s.Out2    lc.Sentence",
+		`cannot tap "nosuchedge"`,
+		"unknown command :frobnicate",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "Words: 2\n") {
+		t.Errorf("the line after :quit was sent:\n%s", out.String())
+	}
+}
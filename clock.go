@@ -0,0 +1,117 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// A `clock` tells the time. Nodes that work with time, like timeouts or time
+// windows, should take a `clock` rather than calling the `time` package
+// directly, so that tests can run them on a `virtualClock`. The network's
+// clock is available through `network.Clock()`.
+type clock interface {
+	Now() time.Time
+	// `After` works like `time.After`.
+	After(d time.Duration) <-chan time.Time
+}
+
+// `observeAfter` works like `c.After`, for code that only watches the
+// network, like `Monitor`. On a `virtualClock`, the timer fires whenever the
+// clock gets there, but the deterministic scheduler does not advance the
+// clock for it, so it does not keep the network from finishing.
+func observeAfter(c clock, d time.Duration) <-chan time.Time {
+	if vc, ok := c.(*virtualClock); ok {
+		return vc.after(d, true)
+	}
+	return c.After(d)
+}
+
+// `realClock` is the wall clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// `virtualClock` only moves when it is told to, through `Advance`, or when
+// the deterministic scheduler finds the network idle. Timers fire in the
+// order of their deadlines, and timers with the same deadline fire in the
+// order they were created.
+type virtualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []virtualTimer
+}
+
+type virtualTimer struct {
+	at time.Time
+	c  chan time.Time
+	// Background timers fire when the clock passes them, but `next` does
+	// not move the clock for them; see `observeAfter`.
+	background bool
+}
+
+func newVirtualClock(start time.Time) *virtualClock {
+	return &virtualClock{now: start}
+}
+
+func (c *virtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *virtualClock) After(d time.Duration) <-chan time.Time {
+	return c.after(d, false)
+}
+
+func (c *virtualClock) after(d time.Duration, background bool) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// The channel has room for the time, so that firing a timer never
+	// blocks the clock.
+	t := virtualTimer{c.now.Add(d), make(chan time.Time, 1), background}
+	if d <= 0 {
+		t.c <- c.now
+		return t.c
+	}
+	i := sort.Search(len(c.timers), func(i int) bool {
+		return c.timers[i].at.After(t.at)
+	})
+	c.timers = append(c.timers, virtualTimer{})
+	copy(c.timers[i+1:], c.timers[i:])
+	c.timers[i] = t
+	return t.c
+}
+
+// `Advance` moves the clock forward by `d` and fires all timers that are due.
+func (c *virtualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advanceTo(c.now.Add(d))
+}
+
+// `next` moves the clock forward to the next deadline and fires the timers
+// that are due then. It returns false if no timer is waiting.
+func (c *virtualClock) next() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range c.timers {
+		if !t.background {
+			c.advanceTo(t.at)
+			return true
+		}
+	}
+	return false
+}
+
+// The caller must hold `c.mu`.
+func (c *virtualClock) advanceTo(t time.Time) {
+	if t.After(c.now) {
+		c.now = t
+	}
+	for len(c.timers) > 0 && !c.timers[0].at.After(c.now) {
+		c.timers[0].c <- c.timers[0].at
+		c.timers = c.timers[1:]
+	}
+}
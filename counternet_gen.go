@@ -0,0 +1,45 @@
+// Code generated by fbpgen from counternet.fbp. DO NOT EDIT.
+
+package main
+
+// `newCounterNet` creates the nodes and channels of the network in
+// counternet.fbp, connects them, and starts the nodes.
+// It returns the network's ports In, Done.
+func newCounterNet() (chan<- string, <-chan struct{}) {
+	// Create the processor nodes.
+	s := &splitter{}
+	wc := &wordCounter{}
+	lc := &letterCounter{}
+	p := &printer{}
+
+	// Create the channels for the network.
+	in := make(chan string, 10)
+	sToWc := make(chan string, 10)
+	sToLc := make(chan string, 10)
+	wcToP := make(chan *count, 10)
+	lcToP := make(chan *count, 10)
+	done := make(chan struct{})
+
+	// Connect the nodes to each other.
+	s.In = in
+	s.Out1 = sToWc
+	s.Out2 = sToLc
+
+	wc.Sentence = sToWc
+	wc.Count = wcToP
+
+	lc.Sentence = sToLc
+	lc.Count = lcToP
+
+	p.Line1 = wcToP
+	p.Line2 = lcToP
+	p.Done = done
+
+	// Start the nodes.
+	s.Process()
+	wc.Process()
+	lc.Process()
+	p.Process()
+
+	return in, done
+}
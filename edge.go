@@ -0,0 +1,360 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// `edgeStats` is a snapshot of the traffic on a single edge.
+type edgeStats struct {
+	Name string
+	// Packets the producer has put into the edge, and packets the consumer
+	// has taken out.
+	Sent, Received uint64
+	// Current number of buffered packets, and the capacity of the buffer.
+	Len, Cap int
+	// Time the producer spent blocked on a send because the buffer was
+	// full. A send that is still blocked counts once it completes; see
+	// `hold` for how the edge sees it start.
+	Blocked time.Duration
+	// Time during which the buffer was empty, so that a consumer trying to
+	// receive would have been idle.
+	Idle time.Duration
+}
+
+func (s edgeStats) String() string {
+	return fmt.Sprintf("%s: sent %d, received %d, len/cap %d/%d, blocked %v, idle %v",
+		s.Name, s.Sent, s.Received, s.Len, s.Cap, s.Blocked, s.Idle)
+}
+
+// `edge` is an instrumented replacement for a buffered channel between two
+// nodes. The producer sends to `In()`, the consumer receives from `Out()`, and
+// a goroutine in between moves the packets through a buffer of the given
+// capacity, counting them and measuring how long the producer waits for room
+// and the consumer waits for packets. In deterministic mode (see `Deterministic`), there is no such
+// goroutine, and the scheduler moves the packets one at a time.
+//
+// The nodes do not notice any difference: both ends are plain channels, and
+// closing the producer side closes the consumer side after all buffered
+// packets have been delivered.
+type edge[T any] struct {
+	name     string
+	net      *network
+	from, to port
+	in       chan T
+	out      chan T
+	capacity int
+
+	mu    sync.Mutex
+	stats edgeStats
+	since time.Time
+	queue []packet[T]
+	// The packet of a send that found the buffer full, and when it came;
+	// see `hold`.
+	held      T
+	holding   bool
+	heldSince time.Time
+	inClosed  bool
+	drained   bool
+	taps      []*tap
+}
+
+// A `packet` is a value in the buffer of an edge, together with the trace
+// context of the packet and the time it entered the edge.
+type packet[T any] struct {
+	value    T
+	trace    traceContext
+	enqueued time.Time
+}
+
+// `newEdge` creates an edge, registers it with the network, and starts
+// moving packets. The edge hands packets over through a buffer, so unlike a
+// channel, it cannot be unbuffered: a capacity below one panics.
+func newEdge[T any](n *network, name string, capacity int) *edge[T] {
+	if capacity < 1 {
+		panic(fmt.Sprintf("edge %s: capacity %d, but edges need a capacity of at least 1", name, capacity))
+	}
+	e := &edge[T]{
+		name:     name,
+		net:      n,
+		in:       make(chan T),
+		out:      make(chan T),
+		capacity: capacity,
+		since:    n.clock.Now(),
+	}
+	n.add(e)
+	if n.sched == nil {
+		go e.run()
+	}
+	return e
+}
+
+// `In` is the producer's end of the edge.
+func (e *edge[T]) In() chan<- T {
+	return e.in
+}
+
+// `Out` is the consumer's end of the edge.
+func (e *edge[T]) Out() <-chan T {
+	return e.out
+}
+
+func (e *edge[T]) Name() string {
+	return e.name
+}
+
+// `Connect` records which node ports the edge connects, similar to
+// `Connect()` in `goflow`. An empty node name stands for the outside world,
+// for example at the network's input edge. The network uses the endpoints to
+// attribute traffic to nodes.
+func (e *edge[T]) Connect(fromNode, fromPort, toNode, toPort string) *edge[T] {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.from = port{fromNode, fromPort}
+	e.to = port{toNode, toPort}
+	return e
+}
+
+func (e *edge[T]) Endpoints() (from, to port) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.from, e.to
+}
+
+func (e *edge[T]) closed() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.inClosed
+}
+
+func (e *edge[T]) addTap(t *tap) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.taps = append(e.taps, t)
+}
+
+// `removeTap` builds a new slice rather than changing the old one, which
+// `run` may still be reading.
+func (e *edge[T]) removeTap(t *tap) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var taps []*tap
+	for _, x := range e.taps {
+		if x != t {
+			taps = append(taps, x)
+		}
+	}
+	e.taps = taps
+}
+
+// `run` moves packets from `in` to `out` until `in` is closed and the buffer
+// is empty. In deterministic mode, the scheduler moves the packets instead,
+// through `collect` and `deliver`.
+func (e *edge[T]) run() {
+	for {
+		// Only this goroutine changes the queue, so it can read it without
+		// holding the lock.
+		n := len(e.queue)
+
+		// A nil channel blocks forever, so this disables receiving while
+		// a packet is held back, and sending while the buffer is empty.
+		var recv <-chan T
+		if !e.inClosed && !e.holding {
+			recv = e.in
+		}
+		var send chan<- T
+		var next packet[T]
+		if n > 0 {
+			send = e.out
+			next = e.queue[0]
+		}
+		if recv == nil && send == nil {
+			e.finish()
+			return
+		}
+
+		select {
+		case v, ok := <-recv:
+			if ok && n == e.capacity {
+				e.hold(v)
+			} else {
+				e.accept(v, ok)
+			}
+		case send <- next.value:
+			e.handOver()
+			e.release()
+		}
+	}
+}
+
+// `accept` puts a packet that the producer has sent into the buffer, or
+// marks the edge as closed if `ok` is false.
+func (e *edge[T]) accept(v T, ok bool) {
+	now := e.net.clock.Now()
+	from, _ := e.Endpoints()
+	var tc traceContext
+	if ok {
+		tc = e.net.sent(from.Node, e.name, now)
+	}
+	e.mu.Lock()
+	e.account(now)
+	if ok {
+		e.queue = append(e.queue, packet[T]{v, tc, now})
+		e.stats.Sent++
+	} else {
+		e.inClosed = true
+	}
+	taps := e.taps
+	e.mu.Unlock()
+	if ok {
+		for _, t := range taps {
+			t.offer(e.name, now, v)
+		}
+	}
+}
+
+// `handOver` removes the packet that the consumer has just taken from the
+// buffer.
+func (e *edge[T]) handOver() {
+	now := e.net.clock.Now()
+	e.mu.Lock()
+	e.account(now)
+	next := e.queue[0]
+	e.queue[0] = packet[T]{}
+	e.queue = e.queue[1:]
+	e.stats.Received++
+	to := e.to
+	e.mu.Unlock()
+	e.net.received(to, e.name, now, next.trace, next.enqueued)
+}
+
+// `hold` keeps back the packet of a send that found the buffer full. The
+// edge cannot see a blocked send without taking its packet, so it takes the
+// packet right away, to know when the producer started to wait, but treats
+// it as not sent yet: the packet is not counted, tapped or traced until
+// `release` puts it into the buffer, and the producer's next send waits
+// until then. For the producer, the edge is therefore one packet longer
+// than its capacity.
+func (e *edge[T]) hold(v T) {
+	now := e.net.clock.Now()
+	e.mu.Lock()
+	e.held, e.holding, e.heldSince = v, true, now
+	e.mu.Unlock()
+}
+
+// `release` is called when the buffer has got room. It puts the held
+// packet, if there is one, into the buffer, and counts the time since the
+// packet came as blocked.
+func (e *edge[T]) release() {
+	e.mu.Lock()
+	if !e.holding {
+		e.mu.Unlock()
+		return
+	}
+	v := e.held
+	var zero T
+	e.held, e.holding = zero, false
+	e.stats.Blocked += e.net.clock.Now().Sub(e.heldSince)
+	e.mu.Unlock()
+	e.accept(v, true)
+}
+
+// `finish` closes the consumer's end after the last packet.
+func (e *edge[T]) finish() {
+	e.mu.Lock()
+	e.account(e.net.clock.Now())
+	e.drained = true
+	e.mu.Unlock()
+	close(e.out)
+}
+
+// `collect` takes a single packet, or the close, from the producer. If
+// `wait` is false, `collect` only takes a packet that the producer is
+// already trying to send. If the buffer is full, `collect` never waits, and
+// holds back the packet it takes. It reports whether it took anything.
+func (e *edge[T]) collect(wait bool) bool {
+	if e.inClosed || e.holding {
+		return false
+	}
+	if len(e.queue) == e.capacity {
+		select {
+		case v, ok := <-e.in:
+			if ok {
+				e.hold(v)
+			} else {
+				e.accept(v, ok)
+			}
+			return true
+		default:
+			return false
+		}
+	}
+	if wait {
+		v, ok := <-e.in
+		e.accept(v, ok)
+		return true
+	}
+	select {
+	case v, ok := <-e.in:
+		e.accept(v, ok)
+		return true
+	default:
+		return false
+	}
+}
+
+// `deliver` hands the next packet to the consumer, or closes the consumer's
+// end if the buffer is empty and the producer has closed the edge. If `wait`
+// is false, `deliver` only hands over a packet if the consumer is already
+// waiting for it. It reports whether anything moved.
+func (e *edge[T]) deliver(wait bool) bool {
+	if e.drained {
+		return false
+	}
+	if len(e.queue) == 0 {
+		if !e.inClosed {
+			return false
+		}
+		e.finish()
+		return true
+	}
+	if wait {
+		e.out <- e.queue[0].value
+		e.handOver()
+		e.release()
+		return true
+	}
+	select {
+	case e.out <- e.queue[0].value:
+		e.handOver()
+		e.release()
+		return true
+	default:
+		return false
+	}
+}
+
+// `account` adds the time since the last change of the buffer to the idle
+// time, if the buffer was empty. The caller must hold `e.mu`.
+func (e *edge[T]) account(now time.Time) {
+	if e.drained {
+		return
+	}
+	if len(e.queue) == 0 {
+		e.stats.Idle += now.Sub(e.since)
+	}
+	e.since = now
+}
+
+// `Stats` returns a snapshot of the edge's traffic so far.
+func (e *edge[T]) Stats() edgeStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.account(e.net.clock.Now())
+	s := e.stats
+	s.Name = e.name
+	s.Len = len(e.queue)
+	s.Cap = e.capacity
+	return s
+}
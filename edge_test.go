@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// `waitFor` polls `cond` until it returns true, or fails the test after a
+// second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// `sendBlocked` reports whether a goroutine of this file is blocked on a
+// channel send.
+func sendBlocked() bool {
+	for _, g := range goroutines() {
+		if g.State == "chan send" && strings.Contains(g.Stack, "edge_test.go") {
+			return true
+		}
+	}
+	return false
+}
+
+// `holding` reports whether the edge holds back a packet of a send that
+// found the buffer full.
+func holding[T any](e *edge[T]) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.holding
+}
+
+// `virtualNetwork` returns a network whose edges take their timestamps from a
+// virtual clock, but that still moves packets concurrently.
+func virtualNetwork() (*network, *virtualClock) {
+	n := newNetwork()
+	c := newVirtualClock(virtualEpoch)
+	n.clock = c
+	return n, c
+}
+
+func TestEdgeStats(t *testing.T) {
+	n, clock := virtualNetwork()
+	e := newEdge[int](n, "e", 2)
+
+	clock.Advance(10 * time.Millisecond)
+	e.In() <- 1
+	e.In() <- 2
+	waitFor(t, "the buffer is full", func() bool { return e.Stats().Len == 2 })
+	clock.Advance(30 * time.Millisecond)
+	<-e.Out()
+	waitFor(t, "the edge has handed over the packet", func() bool { return e.Stats().Received == 1 })
+
+	s := e.Stats()
+	want := edgeStats{Name: "e", Sent: 2, Received: 1, Len: 1, Cap: 2, Idle: 10 * time.Millisecond}
+	if s != want {
+		t.Errorf("got %v, want %v", s, want)
+	}
+	close(e.In())
+	<-e.Out()
+	if _, ok := <-e.Out(); ok {
+		t.Error("the edge did not close its output")
+	}
+	if s := e.Stats(); s.Sent != 2 || s.Received != 2 || s.Len != 0 {
+		t.Errorf("after closing, got %v", s)
+	}
+}
+
+func TestEdgeBlocked(t *testing.T) {
+	t.Run("slow consumer", func(t *testing.T) {
+		n, clock := virtualNetwork()
+		e := newEdge[int](n, "e", 2)
+		go func() {
+			for i := 0; i < 5; i++ {
+				e.In() <- i
+			}
+			close(e.In())
+		}()
+		// The consumer takes a packet every 30ms. Meanwhile, the edge
+		// holds back the third and then the fourth packet, and the
+		// producer is stuck on the next one.
+		for i := 0; i < 2; i++ {
+			waitFor(t, "the producer blocks", func() bool { return holding(e) && sendBlocked() })
+			clock.Advance(30 * time.Millisecond)
+			<-e.Out()
+		}
+		for range e.Out() {
+		}
+		if s := e.Stats(); s.Blocked != 60*time.Millisecond {
+			t.Errorf("got blocked time %v, want 60ms", s.Blocked)
+		}
+	})
+
+	t.Run("idle producer", func(t *testing.T) {
+		n, clock := virtualNetwork()
+		e := newEdge[int](n, "e", 2)
+		e.In() <- 1
+		e.In() <- 2
+		waitFor(t, "the buffer is full", func() bool { return e.Stats().Len == 2 })
+		// The buffer is full, but nobody tries to send.
+		clock.Advance(30 * time.Millisecond)
+		<-e.Out()
+		waitFor(t, "the edge has handed over the packet", func() bool { return e.Stats().Received == 1 })
+		e.In() <- 3
+		close(e.In())
+		for range e.Out() {
+		}
+		if s := e.Stats(); s.Blocked != 0 {
+			t.Errorf("got blocked time %v, want 0", s.Blocked)
+		}
+	})
+
+	t.Run("late producer", func(t *testing.T) {
+		n, clock := virtualNetwork()
+		e := newEdge[int](n, "e", 2)
+		e.In() <- 1
+		e.In() <- 2
+		waitFor(t, "the buffer is full", func() bool { return e.Stats().Len == 2 })
+		// The buffer was full for 30ms before the producer tried to
+		// send, which does not count.
+		clock.Advance(30 * time.Millisecond)
+		e.In() <- 3
+		waitFor(t, "the edge holds the packet", func() bool { return holding(e) })
+		clock.Advance(20 * time.Millisecond)
+		<-e.Out()
+		waitFor(t, "the edge takes the held packet", func() bool { return e.Stats().Sent == 3 })
+		close(e.In())
+		for range e.Out() {
+		}
+		if s := e.Stats(); s.Blocked != 20*time.Millisecond {
+			t.Errorf("got blocked time %v, want 20ms", s.Blocked)
+		}
+	})
+}
+
+func TestEdgeCapacity(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "capacity of at least 1") {
+			t.Errorf("got %v, want a panic for capacity 0", r)
+		}
+	}()
+	newEdge[int](newNetwork(), "e", 0)
+}
+
+func TestMonitor(t *testing.T) {
+	n := newNetwork()
+	e := newEdge[int](n, "e", 3)
+	e.In() <- 1
+	snapshots := make(chan []edgeStats, 10)
+	stop := n.Monitor(time.Millisecond, func(stats []edgeStats) {
+		select {
+		case snapshots <- stats:
+		default:
+		}
+	})
+	var s []edgeStats
+	waitFor(t, "the monitor reports the packet", func() bool {
+		select {
+		case s = <-snapshots:
+		default:
+		}
+		return len(s) == 1 && s[0].Len == 1
+	})
+	stop()
+	stop()
+	if s[0].Name != "e" || s[0].Cap != 3 || s[0].Sent != 1 {
+		t.Errorf("got snapshot %v", s)
+	}
+	close(e.In())
+	for range e.Out() {
+	}
+}
+
+// In deterministic mode, the monitor takes its snapshots in virtual time,
+// but it does not keep the scheduler from finishing.
+func TestMonitorDeterministic(t *testing.T) {
+	_, restore := captureStdout(t)
+	defer restore()
+	n := newNetwork()
+	sched := n.Deterministic(1)
+	in, done := buildCounterNet(n, 2)
+	var times []time.Time
+	stop := n.Monitor(time.Millisecond, func([]edgeStats) {
+		times = append(times, n.Clock().Now())
+	})
+	defer stop()
+	go func() {
+		in <- "Why?"
+		close(in)
+	}()
+	if err := sched.Run(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if len(times) != 0 {
+		t.Errorf("got snapshots at %v, but the clock never moved", times)
+	}
+}
+
+func TestNodeStats(t *testing.T) {
+	_, restore := captureStdout(t)
+	defer restore()
+	// In deterministic mode, the scheduler accounts for every packet before
+	// the next one moves, so even the latencies are exact.
+	n := newNetwork()
+	sched := n.Deterministic(1)
+	in, done := buildCounterNet(n, 2)
+	go func() {
+		for _, s := range []string{"Why?", "Because.", "Life is too important to be taken seriously."} {
+			in <- s
+		}
+		close(in)
+	}()
+	if err := sched.Run(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	// The splitter only reports the latency of its first output.
+	want := []nodeStats{
+		{Name: "splitter", Type: "splitter", Received: 3, Sent: 6, Latency: histogram{Count: 3}},
+		{Name: "wordCounter", Type: "wordCounter", Received: 3, Sent: 3, Latency: histogram{Count: 3}},
+		{Name: "letterCounter", Type: "letterCounter", Received: 3, Sent: 3, Latency: histogram{Count: 3}},
+		{Name: "printer", Type: "printer", Received: 6},
+	}
+	stats := n.NodeStats()
+	if len(stats) != len(want) {
+		t.Fatalf("got %d nodes, want %d", len(stats), len(want))
+	}
+	for i, s := range stats {
+		w := want[i]
+		if s.Name != w.Name || s.Type != w.Type || s.Received != w.Received || s.Sent != w.Sent || s.Latency.Count != w.Latency.Count {
+			t.Errorf("got %s (%s): received %d, sent %d, %d latencies; want %s (%s): %d, %d, %d",
+				s.Name, s.Type, s.Received, s.Sent, s.Latency.Count, w.Name, w.Type, w.Received, w.Sent, w.Latency.Count)
+		}
+	}
+}
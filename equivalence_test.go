@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/appliedgo/flow2go/internal/equivalence"
+	"github.com/appliedgo/flow2go/internal/graph"
+)
+
+func TestEquivalence(t *testing.T) {
+	nets := []struct {
+		name  string
+		build func() (chan<- string, <-chan struct{})
+	}{
+		{"instrumented", func() (chan<- string, <-chan struct{}) { return buildCounterNet(newNetwork(), 10) }},
+		{"plain", startPlainNet},
+		{"generated", newCounterNet},
+		{"registry", func() (chan<- string, <-chan struct{}) {
+			g, err := graph.Load("counternet.fbp")
+			if err != nil {
+				t.Fatal(err)
+			}
+			gn, err := buildGraph(g, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gn.start()
+			return gn.Inports["In"].Interface().(chan<- string), gn.Outports["Done"].Interface().(<-chan struct{})
+		}},
+	}
+	for _, net := range nets {
+		t.Run(net.name, func(t *testing.T) {
+			equivalence.Check(t, "testdata/equivalence.json", "pure", func(input []string) {
+				in, done := net.build()
+				for _, s := range input {
+					in <- s
+				}
+				close(in)
+				<-done
+			})
+		})
+	}
+}
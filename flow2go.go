@@ -104,17 +104,32 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"unicode"
 )
 
 // Every type or func below this point was taken over from the previous article's code. Wherever I had to make a change, a comment explains what and why.
 //
 // In the GitHub repository for this article you can find the file `flow.go` that contains the original code from the previous article, for easy comparison. (As always, find the `go get` instructions at the end of the article.)
+//
+// `count` got a `scale` for counters whose values have decimals, like averages. Such a counter sends the value times the scale, and the printer divides it again: a `count` of 450 with a `scale` of 100 prints as 4.50. Whole counts have a scale of 1.
 type count struct {
 	tag   string
 	count int
+	scale int
+}
+
+// `value` formats the count in units of its scale, a power of ten, with as many decimals as the scale has zeros.
+func (c *count) value() string {
+	if c.scale <= 1 {
+		return strconv.Itoa(c.count)
+	}
+	decimals := len(strconv.Itoa(c.scale)) - 1
+	return strconv.FormatFloat(float64(c.count)/float64(c.scale), 'f', decimals, 64)
 }
 
 type splitter struct {
@@ -143,12 +158,18 @@ func (t *splitter) Process() {
 type wordCounter struct {
 	Sentence <-chan string
 	Count    chan<- *count
+	// `Tokenize` splits a sentence into words. If it is nil, `wordCounter` uses `strings.Fields`, which splits at any whitespace. (Splitting at single spaces, as the previous article did, counts an empty sentence as one word and every double space as an extra word.) See tokenizer.go for tokenizers that know about punctuation and non-English text.
+	Tokenize func(string) []string
 }
 
 // Previously, this function was named OnSentence, and it was a one-liner that received a string via the `goflow` framework. As with `splitter`'s `OnIn()`, let's replace it by a function that reads the input channel directly.
 func (wc *wordCounter) Process() {
 	fmt.Println("WordCounter starts.")
 	go func() {
+		tokenize := wc.Tokenize
+		if tokenize == nil {
+			tokenize = strings.Fields
+		}
 		for {
 			sentence, ok := <-wc.Sentence
 			if !ok {
@@ -156,7 +177,7 @@ func (wc *wordCounter) Process() {
 				close(wc.Count)
 				return
 			}
-			wc.Count <- &count{"Words", len(strings.Split(sentence, " "))}
+			wc.Count <- &count{"Words", len(tokenize(sentence)), 1}
 		}
 	}()
 }
@@ -164,14 +185,16 @@ func (wc *wordCounter) Process() {
 type letterCounter struct {
 	Sentence <-chan string
 	Count    chan<- *count
-	re       *regexp.Regexp
+	// `Classes` lists the Unicode categories or scripts whose runes count, for example `unicode.Letter`, `unicode.Digit`, `unicode.Punct`, or `unicode.Greek`. If it is empty, `letterCounter` counts the letters of all scripts, so unlike the `[a-zA-Z]` of the previous article, "ä", "é", "ß", and "Ж" count, too.
+	Classes []*unicode.RangeTable
+	// `Pattern` switches back to counting with a regular expression, where each match counts as one letter. It takes precedence over `Classes`. Keep in mind that this is slower, as `FindAllStringIndex` allocates a slice of matches for every sentence, while looking up runes in `Classes` allocates nothing. The pattern is compiled by whoever sets it, so that an invalid pattern is an error there rather than a panic in the node's goroutine.
+	Pattern *regexp.Regexp
 }
 
 // As with `wordCounter`,  `letterCounter`'s `OnSentence` function also got replaced by a function that reads the input channel directly.
 func (lc *letterCounter) Process() {
 	fmt.Println("LetterCounter starts.")
 	go func() {
-		lc.Init()
 		for {
 			sentence, ok := <-lc.Sentence
 			if !ok {
@@ -179,13 +202,23 @@ func (lc *letterCounter) Process() {
 				close(lc.Count)
 				return
 			}
-			lc.Count <- &count{"Letters", len(lc.re.FindAllString(sentence, -1))}
+			lc.Count <- &count{"Letters", lc.letters(sentence), 1}
 		}
 	}()
 }
 
-func (lc *letterCounter) Init() {
-	lc.re = regexp.MustCompile("[a-zA-Z]")
+// `letters` counts the runes of the sentence that belong to one of the classes, or the matches of the pattern.
+func (lc *letterCounter) letters(sentence string) int {
+	if lc.Pattern != nil {
+		return len(lc.Pattern.FindAllStringIndex(sentence, -1))
+	}
+	n := 0
+	for _, r := range sentence {
+		if len(lc.Classes) == 0 && unicode.IsLetter(r) || len(lc.Classes) > 0 && unicode.In(r, lc.Classes...) {
+			n++
+		}
+	}
+	return n
 }
 
 // printer now has two input channels instead of one, so that each sender can simply close its channel when the data flow ends.
@@ -236,13 +269,20 @@ func (p *printer) Process() {
 				close(p.Done)
 				return
 			}
-			fmt.Println(c.tag+":", c.count)
+			fmt.Println(c.tag+":", c.value())
 		}
 	}()
 }
 
-// Now let's build the flow network with pure Go only.
-func main() {
+// `commandLine` runs the subcommands of the `flow2go` binary, like
+// `./flow2go run counternet.fbp`. It is set in `cli.go`, so it is nil when
+// `go run flow2go.go` compiles this file on its own.
+var commandLine func(args []string) int
+
+// Now let's build the flow network with pure Go only. `startPlainNet` creates
+// the nodes, connects them, and starts them, and returns the network's input
+// channel and the channel that signals the end of the network.
+func startPlainNet() (chan<- string, <-chan struct{}) {
 	// Create the processor nodes.
 	s := &splitter{}
 	wc := &wordCounter{}
@@ -284,6 +324,16 @@ func main() {
 	lc.Process()
 	p.Process()
 
+	return in, done
+}
+
+func main() {
+	if commandLine != nil && len(os.Args) > 1 {
+		os.Exit(commandLine(os.Args[1:]))
+	}
+
+	in, done := startPlainNet()
+
 	// Now feed the network with data.
 
 	fmt.Println("Send the data into the network.")
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// `follower` is a source for files that keep growing, like logs. Like
+// `tail -F`, it sends every line that is appended to the file at `Path`, and
+// keeps waiting for more. So unlike `fileSource`, it does not close `Out` at
+// the end of the file, but only when `Stop` is closed.
+//
+// `follower` survives log rotation: when `Path` is replaced by a new file,
+// it reads the old file to the end and continues with the new one from the
+// start. When the file is truncated, it starts over from the start, too. It
+// detects truncation by the file getting smaller than what it has read
+// already, so it misses a truncation if the file grows back to that size
+// before the next poll.
+type follower struct {
+	Out  chan<- string
+	Stop <-chan struct{}
+	Path string
+	// `OffsetFile` is where `follower` persists how far it has read, so
+	// that it can resume there after a restart. It saves the offset after
+	// each burst of lines, and when it stops. If the saved offset is beyond
+	// the end of the file, the file was rotated or truncated in between, and
+	// `follower` starts from the beginning.
+	OffsetFile string
+	// Without a saved offset, `follower` starts at the end of the file,
+	// unless `FromStart` is set.
+	FromStart bool
+	// How often to check the file for new lines. Defaults to 250ms.
+	Poll time.Duration
+	// `OnError` receives errors like an unreadable file or offset file.
+	// Defaults to printing the error to stderr.
+	OnError func(error)
+}
+
+func (fl *follower) Process() {
+	fmt.Println("Follower starts.")
+	go func() {
+		fl.follow()
+		fmt.Println("Follower has finished.")
+		close(fl.Out)
+	}()
+}
+
+func (fl *follower) follow() {
+	poll := fl.Poll
+	if poll <= 0 {
+		poll = 250 * time.Millisecond
+	}
+	onError := fl.OnError
+	if onError == nil {
+		onError = func(err error) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	offset, err := fl.loadOffset()
+	if err != nil {
+		onError(err)
+	}
+	saved := offset
+	save := func() {
+		if fl.OffsetFile == "" || offset == saved || offset < 0 {
+			return
+		}
+		if err := fl.saveOffset(offset); err != nil {
+			onError(err)
+		}
+		saved = offset
+	}
+	defer save()
+
+	var f *os.File
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	var pending []byte
+	buf := make([]byte, 32*1024)
+
+	// `send` returns false if the follower was stopped before the line
+	// could be sent.
+	send := func(line string) bool {
+		select {
+		case fl.Out <- strings.TrimSuffix(line, "\r"):
+			return true
+		case <-fl.Stop:
+			return false
+		}
+	}
+
+	for {
+		if f == nil {
+			f, err = fl.open(offset)
+			switch {
+			case os.IsNotExist(err) && offset < 0:
+				// A file that is created later is new, so read all of it.
+				offset = 0
+			case err != nil && !os.IsNotExist(err):
+				onError(err)
+			}
+			if f != nil {
+				offset, _ = f.Seek(0, io.SeekCurrent)
+				pending = pending[:0]
+			}
+		}
+		if f != nil {
+			n, err := f.Read(buf)
+			if n > 0 {
+				pending = append(pending, buf[:n]...)
+				for {
+					i := bytes.IndexByte(pending, '\n')
+					if i < 0 {
+						break
+					}
+					if !send(string(pending[:i])) {
+						return
+					}
+					offset += int64(i + 1)
+					pending = pending[i+1:]
+				}
+				continue
+			}
+			if err != nil && err != io.EOF {
+				onError(fmt.Errorf("%s: %v", fl.Path, err))
+			}
+			switch fl.changed(f, offset+int64(len(pending))) {
+			case rotated:
+				// The rest of the old file will never get a line break.
+				if len(pending) > 0 && !send(string(pending)) {
+					return
+				}
+				f.Close()
+				f, offset = nil, 0
+				continue
+			case truncated:
+				f.Seek(0, io.SeekStart)
+				offset, pending = 0, pending[:0]
+				continue
+			}
+		}
+		save()
+		select {
+		case <-fl.Stop:
+			return
+		case <-time.After(poll):
+		}
+	}
+}
+
+// `open` opens the file and seeks to `offset`, or to where reading should
+// start if `offset` is negative.
+func (fl *follower) open(offset int64) (*os.File, error) {
+	f, err := os.Open(fl.Path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	switch {
+	case offset < 0 && !fl.FromStart:
+		offset = info.Size()
+	case offset < 0, offset > info.Size():
+		offset = 0
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+type fileChange int
+
+const (
+	unchanged fileChange = iota
+	rotated
+	truncated
+)
+
+// `changed` checks whether the open file `f`, which has been read up to
+// `read`, was rotated or truncated.
+func (fl *follower) changed(f *os.File, read int64) fileChange {
+	old, err := f.Stat()
+	if err != nil {
+		return unchanged
+	}
+	cur, err := os.Stat(fl.Path)
+	switch {
+	case err != nil:
+		// The file was moved away, and the new one is not there yet. Keep
+		// reading the old one, which might still get written to.
+		return unchanged
+	case !os.SameFile(old, cur):
+		return rotated
+	case old.Size() < read:
+		return truncated
+	}
+	return unchanged
+}
+
+// `loadOffset` returns the saved offset, or -1 if there is none.
+func (fl *follower) loadOffset() (int64, error) {
+	if fl.OffsetFile == "" {
+		return -1, nil
+	}
+	b, err := os.ReadFile(fl.OffsetFile)
+	if os.IsNotExist(err) {
+		return -1, nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil || offset < 0 {
+		return -1, fmt.Errorf("%s: invalid offset %q", fl.OffsetFile, b)
+	}
+	return offset, nil
+}
+
+// `saveOffset` replaces the offset file atomically, so that a crash cannot
+// leave a half-written offset behind.
+func (fl *follower) saveOffset(offset int64) error {
+	tmp := fl.OffsetFile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(offset, 10)+"\n"), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fl.OffsetFile)
+}
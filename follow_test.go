@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFollower(t *testing.T) {
+	_, restore := captureStdout(t)
+	defer restore()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	offsets := filepath.Join(dir, "app.offset")
+
+	write := func(flag int, s string) {
+		t.Helper()
+		f, err := os.OpenFile(path, flag|os.O_WRONLY|os.O_CREATE, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := func() (<-chan string, chan struct{}) {
+		out := make(chan string)
+		stop := make(chan struct{})
+		(&follower{
+			Out:        out,
+			Stop:       stop,
+			Path:       path,
+			OffsetFile: offsets,
+			FromStart:  true,
+			Poll:       5 * time.Millisecond,
+			OnError:    func(err error) { t.Error(err) },
+		}).Process()
+		return out, stop
+	}
+	receive := func(out <-chan string, want ...string) {
+		t.Helper()
+		for _, w := range want {
+			select {
+			case got := <-out:
+				if got != w {
+					t.Fatalf("got %q, want %q", got, w)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("timed out waiting for %q", w)
+			}
+		}
+	}
+	stop := func(out <-chan string, stop chan struct{}) {
+		t.Helper()
+		close(stop)
+		select {
+		case line, ok := <-out:
+			if ok {
+				t.Fatalf("got %q after stopping", line)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("follower did not close its output after stopping")
+		}
+	}
+
+	out, s := start()
+	write(os.O_TRUNC, "one\ntwo\r\n")
+	receive(out, "one", "two")
+
+	t.Log("partial line")
+	write(os.O_APPEND, "thr")
+	time.Sleep(20 * time.Millisecond)
+	write(os.O_APPEND, "ee\n")
+	receive(out, "three")
+
+	t.Log("truncation")
+	write(os.O_TRUNC, "four\n")
+	receive(out, "four")
+
+	t.Log("rotation")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	write(os.O_TRUNC, "five\n")
+	receive(out, "five")
+	stop(out, s)
+
+	b, err := os.ReadFile(offsets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(b)); got != "5" {
+		t.Errorf("saved offset %s, want 5", got)
+	}
+
+	t.Log("resume")
+	write(os.O_APPEND, "six\n")
+	out, s = start()
+	receive(out, "six")
+	stop(out, s)
+}
+
+func TestFollowerFromEnd(t *testing.T) {
+	_, restore := captureStdout(t)
+	defer restore()
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := make(chan string)
+	stop := make(chan struct{})
+	fl := &follower{Out: out, Stop: stop, Path: path, Poll: 5 * time.Millisecond}
+	fl.Process()
+	time.Sleep(20 * time.Millisecond)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("new\n")
+	f.Close()
+	select {
+	case got := <-out:
+		if got != "new" {
+			t.Errorf("got %q, want new", got)
+		}
+	case <-time.After(time.Second):
+		t.Error("timed out")
+	}
+	close(stop)
+	for range out {
+	}
+}
@@ -1,9 +1,15 @@
 module github.com/appliedgo/flow2go
 
-go 1.13
+go 1.22.0
 
 require (
-	github.com/gorilla/websocket v1.4.2 // indirect
+	github.com/gorilla/websocket v1.4.2
 	github.com/nu7hatch/gouuid v0.0.0-20131221200532-179d4d0c4d8d // indirect
 	github.com/trustmaster/goflow v0.0.0-20180414123758-47a1b442f390
+	golang.org/x/tools v0.26.0
+)
+
+require (
+	golang.org/x/mod v0.21.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
 )
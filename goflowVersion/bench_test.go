@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/appliedgo/flow2go/internal/benchnet"
+	"github.com/trustmaster/goflow"
+)
+
+// `newBenchNet` constructs a network like `NewCounterNet`, but with any power
+// of two of counters: a tree of splitters fans the input out to the counters,
+// which alternate between words and letters. All counters send to the same
+// printer, as goflow merges the connections to a port by itself.
+func newBenchNet(counters, capacity int) *counterNet {
+	n := &counterNet{}
+	n.InitGraphState()
+	n.Add(&printer{}, "printer")
+	n.Add(&splitter{}, "s0")
+	n.MapInPort("In", "s0", "In")
+	// `outputs` are the splitter ports that still need a receiver.
+	type output struct{ node, port string }
+	outputs := []output{{"s0", "Out1"}, {"s0", "Out2"}}
+	for s := 1; len(outputs) < counters; s++ {
+		name := fmt.Sprintf("s%d", s)
+		n.Add(&splitter{}, name)
+		n.ConnectBuf(outputs[0].node, outputs[0].port, name, "In", capacity)
+		outputs = append(outputs[1:], output{name, "Out1"}, output{name, "Out2"})
+	}
+	for i, o := range outputs {
+		name := fmt.Sprintf("c%d", i)
+		if i%2 == 0 {
+			n.Add(&wordCounter{}, name)
+		} else {
+			n.Add(&letterCounter{}, name)
+		}
+		n.ConnectBuf(o.node, o.port, name, "Sentence", capacity)
+		n.ConnectBuf(name, "Count", "printer", "Line", capacity)
+	}
+	return n
+}
+
+func BenchmarkNetwork(b *testing.B) {
+	benchnet.Run(b, func(counters, capacity int) (chan<- string, func()) {
+		net := newBenchNet(counters, capacity)
+		in := make(chan string, capacity)
+		net.SetInPort("In", in)
+		flow.RunNet(net)
+		return in, func() {
+			<-net.Wait()
+		}
+	})
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/appliedgo/flow2go/internal/equivalence"
+	"github.com/trustmaster/goflow"
+)
+
+func TestEquivalence(t *testing.T) {
+	equivalence.Check(t, "../testdata/equivalence.json", "goflow", func(input []string) {
+		net := NewCounterNet()
+		in := make(chan string)
+		net.SetInPort("In", in)
+		flow.RunNet(net)
+		for _, s := range input {
+			in <- s
+		}
+		close(in)
+		<-net.Wait()
+	})
+}
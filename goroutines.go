@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// `goroutineInfo` describes a goroutine as reported by `runtime.Stack`.
+type goroutineInfo struct {
+	ID int
+	// What the goroutine is doing, for example "running", "chan receive",
+	// "chan send", or "select".
+	State string
+	// The function that started the goroutine, for example
+	// "main.(*printer).merge", and the ID of the goroutine that ran it.
+	Creator string
+	Parent  int
+	Stack   string
+	// The network node that the goroutine belongs to; only set by
+	// `nodeGoroutines`.
+	Node string
+}
+
+var (
+	goroutineHeader = regexp.MustCompile(`^goroutine (\d+) \[([^\],]+)`)
+	createdBy       = regexp.MustCompile(`(?m)^created by (\S+)(?: in goroutine (\d+))?`)
+	nodeMethod      = regexp.MustCompile(`\.\(\*(\w+)\)\.(\w+)$`)
+)
+
+// `goroutines` returns all goroutines of the process.
+func goroutines() []goroutineInfo {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	var gs []goroutineInfo
+	for _, block := range bytes.Split(buf, []byte("\n\n")) {
+		m := goroutineHeader.FindSubmatch(block)
+		if m == nil {
+			continue
+		}
+		id, _ := strconv.Atoi(string(m[1]))
+		g := goroutineInfo{ID: id, State: string(m[2]), Stack: string(block)}
+		if c := createdBy.FindSubmatch(block); c != nil {
+			g.Creator = string(c[1])
+			g.Parent, _ = strconv.Atoi(string(c[2]))
+		}
+		gs = append(gs, g)
+	}
+	return gs
+}
+
+// `NodeType` returns the type of the node whose method started the
+// goroutine, and the name of that method. For a goroutine started by
+// `main.(*printer).merge`, this is "printer" and "merge". Goroutines that
+// were not started by a method return empty strings.
+func (g goroutineInfo) NodeType() (typ, method string) {
+	m := nodeMethod.FindStringSubmatch(g.Creator)
+	if m == nil {
+		return "", ""
+	}
+	return m[1], m[2]
+}
+
+// `currentGoroutine` returns the ID of the calling goroutine.
+func currentGoroutine() int {
+	buf := make([]byte, 64)
+	m := goroutineHeader.FindSubmatch(buf[:runtime.Stack(buf, false)])
+	if m == nil {
+		return 0
+	}
+	id, _ := strconv.Atoi(string(m[1]))
+	return id
+}
+
+// `nodeGoroutines` returns the goroutines of the network's nodes, with
+// `Node` set: the goroutines that `Start` has seen the nodes launch, and the
+// goroutines that these have started since. Goroutines of other networks do
+// not count, even if their nodes are of the same types.
+func (n *network) nodeGoroutines() []goroutineInfo {
+	gs := goroutines()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.adopt(gs)
+	var own []goroutineInfo
+	for _, g := range gs {
+		if node, ok := n.launched[g.ID]; ok {
+			g.Node = node
+			own = append(own, g)
+		}
+	}
+	return own
+}
+
+// `adopt` adds the goroutines that node goroutines have started to the
+// goroutines of the nodes. Goroutines are created after their parents, so
+// in the order of their IDs, parents come first. The caller must hold
+// `n.mu`, and must adopt before forgetting goroutines that have exited.
+func (n *network) adopt(gs []goroutineInfo) {
+	byID := append([]goroutineInfo(nil), gs...)
+	sort.Slice(byID, func(i, j int) bool { return byID[i].ID < byID[j].ID })
+	for _, g := range byID {
+		if _, ok := n.launched[g.ID]; ok {
+			continue
+		}
+		if node, ok := n.launched[g.Parent]; ok {
+			n.launched[g.ID] = node
+		}
+	}
+}
+
+// `blockedOnChannel` reports whether the goroutine waits for a channel
+// operation.
+func (g goroutineInfo) blockedOnChannel() bool {
+	return strings.HasPrefix(g.State, "chan ") || g.State == "select" || g.State == "select (no cases)"
+}
+
+// `waiting` reports whether the goroutine waits for another goroutine,
+// through a channel or through a `sync.WaitGroup` or `sync.Cond`.
+func (g goroutineInfo) waiting() bool {
+	switch g.State {
+	case "semacquire", "sync.WaitGroup.Wait", "sync.Cond.Wait":
+		return true
+	}
+	return g.blockedOnChannel()
+}
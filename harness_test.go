@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// This file contains a small test kit for driving a single node in
+// isolation. It wires every channel field of a node, feeds the input ports,
+// closes them, and collects everything the node sends until it has closed all
+// of its output ports.
+
+// `ports` maps port names to the packets that go in or come out. Map fields
+// like `router.Out` have one port per key, named like "Out[questions]".
+type ports map[string][]interface{}
+
+// How long `drive` waits for a node to close all its outputs.
+const driveTimeout = time.Second
+
+// `drive` runs `node` with the given inputs and returns the packets it sent
+// on each output port. Everything the node prints to stdout is returned as
+// the pseudo port "stdout", one line per packet.
+//
+// Channel fields are wired as follows: a receive-only field is an input port
+// and gets a closed channel that contains the packets from `in`; a send-only
+// field is an output port and gets a fresh channel. For map fields, set the
+// keys you need to nil channels before calling `drive`.
+//
+// `drive` fails the test if the node does not close all of its output ports
+// within `driveTimeout`.
+func drive(t *testing.T, node processor, in ports) ports {
+	t.Helper()
+	v := reflect.ValueOf(node).Elem()
+
+	type output struct {
+		name string
+		ch   reflect.Value
+	}
+	var outputs []output
+	used := map[string]bool{}
+
+	wire := func(name string, typ reflect.Type) (reflect.Value, bool) {
+		switch typ.ChanDir() {
+		case reflect.RecvDir:
+			used[name] = true
+			ch := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, typ.Elem()), len(in[name]))
+			for _, p := range in[name] {
+				ch.Send(packetValue(p, typ.Elem()))
+			}
+			ch.Close()
+			return ch.Convert(typ), true
+		case reflect.SendDir:
+			ch := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, typ.Elem()), 0)
+			outputs = append(outputs, output{name, ch})
+			return ch.Convert(typ), true
+		}
+		return reflect.Value{}, false
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		switch f.Type.Kind() {
+		case reflect.Chan:
+			if ch, ok := wire(f.Name, f.Type); ok {
+				v.Field(i).Set(ch)
+			}
+		case reflect.Map:
+			if f.Type.Elem().Kind() != reflect.Chan || v.Field(i).IsNil() {
+				continue
+			}
+			m := v.Field(i)
+			for _, k := range m.MapKeys() {
+				if ch, ok := wire(f.Name+"["+k.String()+"]", f.Type.Elem()); ok {
+					m.SetMapIndex(k, ch)
+				}
+			}
+		}
+	}
+	for name := range in {
+		if !used[name] {
+			t.Fatalf("%T has no input port %s", node, name)
+		}
+	}
+
+	stdout, restore := captureStdout(t)
+	node.Process()
+
+	// Collect all outputs in parallel, as the node may send to them in any
+	// order.
+	type result struct {
+		name    string
+		packets []interface{}
+	}
+	results := make(chan result)
+	for _, o := range outputs {
+		go func(o output) {
+			var packets []interface{}
+			for {
+				p, ok := o.ch.Recv()
+				if !ok {
+					break
+				}
+				packets = append(packets, p.Interface())
+			}
+			results <- result{o.name, packets}
+		}(o)
+	}
+
+	out := ports{}
+	timeout := time.After(driveTimeout)
+	for range outputs {
+		select {
+		case r := <-results:
+			out[r.name] = r.packets
+		case <-timeout:
+			restore()
+			var open []string
+			for _, o := range outputs {
+				if _, ok := out[o.name]; !ok {
+					open = append(open, o.name)
+				}
+			}
+			t.Fatalf("%T did not close %s within %v after its inputs were closed", node, strings.Join(open, ", "), driveTimeout)
+		}
+	}
+	restore()
+	out["stdout"] = <-stdout
+	return out
+}
+
+// `packetValue` converts a test packet to the element type of a port, so that
+// tests can write `3` for a port of a named integer type, for example.
+func packetValue(p interface{}, typ reflect.Type) reflect.Value {
+	if p == nil {
+		return reflect.Zero(typ)
+	}
+	return reflect.ValueOf(p).Convert(typ)
+}
+
+// `captureStdout` redirects stdout to a pipe. After `restore` is called, the
+// returned channel delivers the lines that were printed in between.
+func captureStdout(t *testing.T) (lines <-chan []interface{}, restore func()) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stdout
+	os.Stdout = w
+
+	ch := make(chan []interface{}, 1)
+	go func() {
+		var lines []interface{}
+		s := bufio.NewScanner(r)
+		for s.Scan() {
+			lines = append(lines, s.Text())
+		}
+		io.Copy(io.Discard, r)
+		ch <- lines
+	}()
+
+	done := false
+	return ch, func() {
+		if done {
+			return
+		}
+		done = true
+		os.Stdout = orig
+		w.Close()
+	}
+}
+
+// `expect` drives `node` and checks the output ports listed in `want`.
+// Ports that are not listed in `want` are only checked for being closed.
+func expect(t *testing.T, node processor, in, want ports) {
+	t.Helper()
+	got := drive(t, node, in)
+	for name, packets := range want {
+		g, ok := got[name]
+		if !ok {
+			t.Errorf("%T has no output port %s", node, name)
+			continue
+		}
+		if len(g) == 0 && len(packets) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(g, packets) {
+			t.Errorf("%T sent %v on %s, want %v", node, format(g), name, format(packets))
+		}
+	}
+}
+
+// `format` prints packets with pointers resolved, so that `*count` values
+// are readable in error messages.
+func format(packets []interface{}) []interface{} {
+	f := make([]interface{}, len(packets))
+	for i, p := range packets {
+		if v := reflect.ValueOf(p); v.Kind() == reflect.Ptr && !v.IsNil() {
+			p = v.Elem().Interface()
+		}
+		f[i] = p
+	}
+	return f
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/appliedgo/flow2go/internal/benchnet"
+)
+
+// `benchNet` builds a `counterNet` with any power of two of counters: a tree
+// of splitters fans the input out to copies of the network from
+// `newCounterNet`, each with a word counter, a letter counter, and a
+// printer. The nodes of the copies are named like "net0/printer".
+func benchNet(counters, capacity int) (chan<- string, counterNet, []chan struct{}) {
+	net := counterNet{}
+	in := make(chan string, capacity)
+	sentences := []<-chan string{in}
+	for len(sentences) < counters/2 {
+		var next []<-chan string
+		for _, ch := range sentences {
+			out1 := make(chan string, capacity)
+			out2 := make(chan string, capacity)
+			net[fmt.Sprintf("fanout%d", len(net))] = &splitter{In: ch, Out1: out1, Out2: out2}
+			next = append(next, out1, out2)
+		}
+		sentences = next
+	}
+
+	var dones []chan struct{}
+	for i, ch := range sentences {
+		done := make(chan struct{})
+		for name, p := range newCounterNet(ch, done, capacity) {
+			net[fmt.Sprintf("net%d/%s", i, name)] = p
+		}
+		dones = append(dones, done)
+	}
+	return in, net, dones
+}
+
+func BenchmarkNetwork(b *testing.B) {
+	benchnet.Run(b, func(counters, capacity int) (chan<- string, func()) {
+		in, net, dones := benchNet(counters, capacity)
+		for node := range net {
+			net[node].Process()
+		}
+		return in, func() {
+			for _, done := range dones {
+				<-done
+			}
+		}
+	})
+}
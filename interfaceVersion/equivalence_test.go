@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/appliedgo/flow2go/internal/equivalence"
+)
+
+func TestEquivalence(t *testing.T) {
+	equivalence.Check(t, "../testdata/equivalence.json", "interface", func(input []string) {
+		in := make(chan string, 10)
+		done := make(chan struct{})
+		net := newCounterNet(in, done, 10)
+		for node := range net {
+			net[node].Process()
+		}
+		for _, s := range input {
+			in <- s
+		}
+		close(in)
+		<-done
+	})
+}
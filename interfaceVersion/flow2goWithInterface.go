@@ -2,9 +2,9 @@ package main
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 	"sync"
+	"unicode"
 )
 
 // The interface that unites all node structs.
@@ -63,7 +63,7 @@ func (wc *wordCounter) Process() {
 				close(wc.Count)
 				return
 			}
-			wc.Count <- &count{"Words", len(strings.Split(sentence, " "))}
+			wc.Count <- &count{"Words", len(strings.Fields(sentence))}
 		}
 	}()
 }
@@ -71,14 +71,12 @@ func (wc *wordCounter) Process() {
 type letterCounter struct {
 	Sentence <-chan string
 	Count    chan<- *count
-	re       *regexp.Regexp
 }
 
 // As with `wordCounter`,  `letterCounter`'s `OnSentence` function also got replaced by a function that reads the input channel directly.
 func (lc *letterCounter) Process() {
 	fmt.Println("LetterCounter starts.")
 	go func() {
-		lc.Init()
 		for {
 			sentence, ok := <-lc.Sentence
 			if !ok {
@@ -86,15 +84,17 @@ func (lc *letterCounter) Process() {
 				close(lc.Count)
 				return
 			}
-			lc.Count <- &count{"Letters", len(lc.re.FindAllString(sentence, -1))}
+			n := 0
+			for _, r := range sentence {
+				if unicode.IsLetter(r) {
+					n++
+				}
+			}
+			lc.Count <- &count{"Letters", n}
 		}
 	}()
 }
 
-func (lc *letterCounter) Init() {
-	lc.re = regexp.MustCompile("[a-zA-Z]")
-}
-
 // printer now has two input channels instead of one, so that each sender can simply close its channel when the data flow ends.
 type printer struct {
 	Line1 <-chan *count
@@ -148,21 +148,16 @@ func (p *printer) Process() {
 	}()
 }
 
-// Now let's build the flow network with pure Go only.
-func main() {
-
+// `newCounterNet` creates the nodes and the channels between them, and
+// connects the nodes to the network's input channel and to the `done`
+// channel that the printer closes when the network has stopped. The
+// channels between the nodes have the given capacity.
+func newCounterNet(in <-chan string, done chan<- struct{}, capacity int) counterNet {
 	// Create the channels for the network.
-	// We do not want to synchronize the nodes, so we use buffered
-	// channels. The channel capacity was chosen arbitrarily.
-	in := make(chan string, 10)
-	sToWc := make(chan string, 10)
-	sToLc := make(chan string, 10)
-	wcToP := make(chan *count, 10)
-	lcToP := make(chan *count, 10)
-
-	// The `done` channel is used by the last node (the "sink") to signal that
-	// the network has stopped.
-	done := make(chan struct{})
+	sToWc := make(chan string, capacity)
+	sToLc := make(chan string, capacity)
+	wcToP := make(chan *count, capacity)
+	lcToP := make(chan *count, capacity)
 
 	// Connect the nodes to each other.
 
@@ -172,7 +167,7 @@ func main() {
 	// Create the processor nodes. We need to initialize all structs here.
 	// Later, any `net["abc"]` is just a Processor (an interface type) and
 	// we have no more access to the structs' fields.
-	net := counterNet{
+	return counterNet{
 		"splitter": &splitter{
 			In:   in,
 			Out1: sToWc,
@@ -192,6 +187,22 @@ func main() {
 			Done:  done,
 		},
 	}
+}
+
+// Now let's build the flow network with pure Go only.
+func main() {
+
+	// The network's input channel. Like the channels between the nodes, it
+	// is buffered.
+	in := make(chan string, 10)
+
+	// The `done` channel is used by the last node (the "sink") to signal that
+	// the network has stopped.
+	done := make(chan struct{})
+
+	// We do not want to synchronize the nodes, so we use buffered
+	// channels. The channel capacity was chosen arbitrarily.
+	net := newCounterNet(in, done, 10)
 
 	// Start the nodes.
 	fmt.Println("Start the nodes.")
@@ -0,0 +1,145 @@
+// Package benchnet runs the same benchmarks against all three
+// implementations of the counter network, so that their results can be
+// compared side by side. Each implementation has a benchmark that calls `Run`
+// with a function that builds and runs its network.
+//
+// To get a table of all results, run
+//
+//	go test -run '^$' -bench Network ./... | go run ./internal/benchtable
+package benchnet
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+)
+
+// The dimensions of the benchmark: the number of sentences fed into the
+// network, the number of counter nodes, and the capacity of the channels.
+// The number of counters must be a power of two, as the networks fan out
+// through `splitter` nodes.
+var (
+	Sentences  = []int{10, 1000}
+	Counters   = []int{2, 8}
+	Capacities = []int{0, 10, 100}
+)
+
+var aphorisms = []string{
+	"I never put off till tomorrow what I can do the day after.",
+	"Fashion is a form of ugliness so intolerable that we have to alter it every six months.",
+	"Life is too important to be taken seriously.",
+}
+
+// `Input` returns `n` sentences.
+func Input(n int) []string {
+	input := make([]string, n)
+	for i := range input {
+		input[i] = aphorisms[i%len(aphorisms)]
+	}
+	return input
+}
+
+// A `Network` builds and starts a fresh network with the given number of
+// counters and channel capacity. It returns the network's input, and a
+// function that waits until the network has shut down after the input was
+// closed.
+type Network func(counters, capacity int) (in chan<- string, wait func())
+
+// `Run` runs a sub-benchmark for every combination of the dimensions. For
+// every run, it starts a network, feeds it the input, closes the input, and
+// waits for the network to shut down.
+//
+// Besides time and allocations per run of the network, `Run` reports the
+// throughput in sentences per second, the time per sentence, and the median
+// and 99th percentile latency of a sentence.
+//
+// The latency is measured from the source to the sink: `Run` notes the time
+// before it sends a sentence, and reads what the printers write to stdout.
+// Every counter prints one result per sentence, in the order of the
+// sentences, so sentence k is through when the printers have printed
+// (k+1)·counters results. (If some counters run ahead of others, their
+// results for later sentences count, too, so the latency can come out a
+// little shorter than the time the slowest counter needs.)
+func Run(b *testing.B, start Network) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		b.Fatal(err)
+	}
+	orig := os.Stdout
+	os.Stdout = w
+	defer func() {
+		os.Stdout = orig
+		w.Close()
+	}()
+	// The printers must never wait for the benchmark, so the sink can take
+	// all results of a run.
+	maxResults := 0
+	for _, n := range Sentences {
+		for _, c := range Counters {
+			maxResults = max(maxResults, n*c)
+		}
+	}
+	results := make(chan time.Time, maxResults)
+	go sink(r, results)
+
+	for _, n := range Sentences {
+		for _, c := range Counters {
+			for _, k := range Capacities {
+				input := Input(n)
+				name := fmt.Sprintf("sentences=%d/counters=%d/cap=%d", n, c, k)
+				b.Run(name, func(b *testing.B) {
+					sent := make([]time.Time, n)
+					arrived := make([]time.Time, n*c)
+					latencies := make([]time.Duration, 0, n*b.N)
+					b.ReportAllocs()
+					b.ResetTimer()
+					begin := time.Now()
+					for i := 0; i < b.N; i++ {
+						in, wait := start(c, k)
+						for j, s := range input {
+							sent[j] = time.Now()
+							in <- s
+						}
+						close(in)
+						wait()
+						for j := range arrived {
+							arrived[j] = <-results
+						}
+						for j := range sent {
+							latencies = append(latencies, arrived[(j+1)*c-1].Sub(sent[j]))
+						}
+					}
+					elapsed := time.Since(begin)
+					b.StopTimer()
+					sentences := float64(n * b.N)
+					b.ReportMetric(sentences/elapsed.Seconds(), "sentences/s")
+					b.ReportMetric(float64(elapsed.Nanoseconds())/sentences, "ns/sentence")
+					slices.Sort(latencies)
+					b.ReportMetric(float64(latencies[len(latencies)/2].Nanoseconds()), "p50-latency-ns")
+					b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-latency-ns")
+				})
+			}
+		}
+	}
+}
+
+// `result` matches the lines that the printers write for a count, like
+// "Words: 12".
+var result = regexp.MustCompile(`^\w+: \d+$`)
+
+// `sink` reads the printers' output and sends the time when each result
+// arrives to `results`.
+func sink(r io.ReadCloser, results chan<- time.Time) {
+	defer r.Close()
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if result.Match(s.Bytes()) {
+			results <- time.Now()
+		}
+	}
+}
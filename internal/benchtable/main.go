@@ -0,0 +1,128 @@
+// `benchtable` reads the output of `go test -bench` for several packages from
+// stdin and prints one table per metric, with a row for every benchmark and a
+// column for every package. This makes it easy to compare the three versions
+// of the counter network:
+//
+//	go test -run '^$' -bench Network ./... | go run ./internal/benchtable
+//
+// If a benchmark ran more than once (see `go test -count`), the table shows
+// the mean.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// The metrics to print, in this order. Other metrics are ignored.
+var metrics = []string{"ns/op", "sentences/s", "ns/sentence", "p50-latency-ns", "p99-latency-ns", "B/op", "allocs/op"}
+
+// `procs` matches the GOMAXPROCS suffix of a benchmark name.
+var procs = regexp.MustCompile(`-\d+$`)
+
+// A `sample` accumulates the results of one metric of one benchmark in one
+// package.
+type sample struct {
+	sum float64
+	n   int
+}
+
+type results struct {
+	pkgs    []string
+	benches []string
+	// Indexed by metric, benchmark, and package.
+	samples map[string]map[string]map[string]*sample
+}
+
+func parse(r io.Reader) (*results, error) {
+	res := &results{samples: map[string]map[string]map[string]*sample{}}
+	seenPkg := map[string]bool{}
+	seenBench := map[string]bool{}
+	pkg := ""
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, "pkg: ") {
+			pkg = path.Base(strings.TrimPrefix(line, "pkg: "))
+			continue
+		}
+		f := strings.Fields(line)
+		// A result line has a name, the number of iterations, and pairs of
+		// values and units.
+		if len(f) < 4 || len(f)%2 != 0 || !strings.HasPrefix(f[0], "Benchmark") {
+			continue
+		}
+		bench := procs.ReplaceAllString(f[0], "")
+		for i := 2; i < len(f); i += 2 {
+			v, err := strconv.ParseFloat(f[i], 64)
+			if err != nil {
+				continue
+			}
+			unit := f[i+1]
+			if res.samples[unit] == nil {
+				res.samples[unit] = map[string]map[string]*sample{}
+			}
+			if res.samples[unit][bench] == nil {
+				res.samples[unit][bench] = map[string]*sample{}
+			}
+			sm := res.samples[unit][bench][pkg]
+			if sm == nil {
+				sm = &sample{}
+				res.samples[unit][bench][pkg] = sm
+			}
+			sm.sum += v
+			sm.n++
+		}
+		if !seenPkg[pkg] {
+			seenPkg[pkg] = true
+			res.pkgs = append(res.pkgs, pkg)
+		}
+		if !seenBench[bench] {
+			seenBench[bench] = true
+			res.benches = append(res.benches, bench)
+		}
+	}
+	return res, s.Err()
+}
+
+func (res *results) print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	for _, m := range metrics {
+		if res.samples[m] == nil {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t\n", m, strings.Join(res.pkgs, "\t"))
+		for _, b := range res.benches {
+			row := []string{b}
+			for _, p := range res.pkgs {
+				sm := res.samples[m][b][p]
+				if sm == nil {
+					row = append(row, "-")
+					continue
+				}
+				row = append(row, strconv.FormatFloat(sm.sum/float64(sm.n), 'f', 0, 64))
+			}
+			fmt.Fprintf(tw, "%s\t\n", strings.Join(row, "\t"))
+		}
+		fmt.Fprintln(tw, "\t")
+	}
+	return tw.Flush()
+}
+
+func main() {
+	res, err := parse(os.Stdin)
+	if err == nil {
+		err = res.print(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "benchtable:", err)
+		os.Exit(1)
+	}
+}
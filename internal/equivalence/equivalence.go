@@ -0,0 +1,114 @@
+// Package equivalence runs the same scenarios against all three
+// implementations of the counter network (goflow, pure Go, and interface
+// based) and checks that they all print the same counts.
+//
+// The scenarios and their golden counts live in testdata/equivalence.json at
+// the root of the repository. Each implementation has a test that calls
+// `Check` with a function that runs its network.
+package equivalence
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+// A `Scenario` is a list of sentences for the network's input, and the count
+// lines the network must print for them, in any order.
+type Scenario struct {
+	Name   string   `json:"name"`
+	Input  []string `json:"input"`
+	Counts []string `json:"counts"`
+	// `Skip` lists the implementations that the scenario does not apply
+	// to: "goflow", "pure" (pure Go), or "interface". The goflow version
+	// still splits words at single spaces and only counts the letters a-z
+	// and A-Z, as in the original article.
+	Skip []string `json:"skip,omitempty"`
+}
+
+// `Load` reads the scenarios from a JSON file.
+func Load(path string) ([]Scenario, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var scenarios []Scenario
+	if err := json.Unmarshal(b, &scenarios); err != nil {
+		return nil, err
+	}
+	return scenarios, nil
+}
+
+// Count lines look like "Words: 13". All other output, like "Printer
+// starts.", is ignored.
+var countLine = regexp.MustCompile(`^\w+: -?\d+$`)
+
+// `Counts` runs `run`, captures everything it prints to stdout, and returns
+// the count lines, sorted.
+func Counts(run func()) ([]string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	orig := os.Stdout
+	os.Stdout = w
+
+	lines := make(chan []string)
+	go func() {
+		var counts []string
+		s := bufio.NewScanner(r)
+		for s.Scan() {
+			if countLine.MatchString(s.Text()) {
+				counts = append(counts, s.Text())
+			}
+		}
+		io.Copy(io.Discard, r)
+		lines <- counts
+	}()
+
+	run()
+	os.Stdout = orig
+	w.Close()
+	counts := <-lines
+	sort.Strings(counts)
+	return counts, nil
+}
+
+// `Check` runs every scenario from `path` that applies to the implementation
+// `impl` through `run` and compares the printed counts with the golden counts
+// of the scenario. `run` must feed the input into a fresh network, close the
+// input, and return after the network has shut down.
+func Check(t *testing.T, path, impl string, run func(input []string)) {
+	t.Helper()
+	scenarios, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sc := range scenarios {
+		sc := sc
+		t.Run(sc.Name, func(t *testing.T) {
+			for _, skip := range sc.Skip {
+				if skip == impl {
+					t.Skipf("does not apply to %s", impl)
+				}
+			}
+			got, err := Counts(func() { run(sc.Input) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := append([]string(nil), sc.Counts...)
+			sort.Strings(want)
+			if len(got) == 0 && len(want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got counts %q, want %q", got, want)
+			}
+		})
+	}
+}
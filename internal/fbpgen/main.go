@@ -0,0 +1,443 @@
+// `fbpgen` turns a graph definition into Go code that wires up the network
+// exactly like `main()` in flow2go.go does by hand: it creates the nodes and
+// the channels, assigns the channels to the nodes' ports, and starts the
+// nodes. The generated code uses no reflection, so a channel that connects
+// ports of different types is a compile error.
+//
+// Use it with `go generate`:
+//
+//	//go:generate go run ./internal/fbpgen -func newCounterNet counternet.fbp
+//
+// The generated function returns the network's inports and outports in the
+// order of the graph definition. See package `graph` for the graph formats.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/appliedgo/flow2go/internal/graph"
+)
+
+// A `port` is a channel field of a node type, or a map of channels.
+type port struct {
+	name string
+	dir  ast.ChanDir
+	// The element type of the channel.
+	elem string
+	// The type of the map, if the field is a map of channels.
+	mapType string
+}
+
+func (p port) input() bool  { return p.dir&ast.RECV != 0 }
+func (p port) output() bool { return p.dir&ast.SEND != 0 }
+
+// A `component` is a node type, with its ports in the order of the struct
+// fields.
+type component struct {
+	name  string
+	ports []port
+}
+
+func (c *component) port(name string) *port {
+	for i := range c.ports {
+		if c.ports[i].name == name {
+			return &c.ports[i]
+		}
+	}
+	return nil
+}
+
+// `pkg` is what the generator needs to know about the target package.
+type pkg struct {
+	name       string
+	components map[string]*component
+	// All package-level names, which the generated variables must not
+	// shadow.
+	idents map[string]bool
+}
+
+// `loadPackage` parses the Go files in `dir`, except tests and the file
+// `skip`, which is the generated file from the last run.
+func loadPackage(dir, skip string) (*pkg, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	p := &pkg{components: map[string]*component{}, idents: map[string]bool{}}
+	fset := token.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") || filepath.Base(name) == filepath.Base(skip) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		p.name = f.Name.Name
+		for _, d := range f.Decls {
+			switch d := d.(type) {
+			case *ast.FuncDecl:
+				if d.Recv == nil {
+					p.idents[d.Name.Name] = true
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						p.idents[s.Name.Name] = true
+						if st, ok := s.Type.(*ast.StructType); ok {
+							p.components[s.Name.Name] = newComponent(s.Name.Name, st)
+						}
+					case *ast.ValueSpec:
+						for _, n := range s.Names {
+							p.idents[n.Name] = true
+						}
+					}
+				}
+			}
+		}
+	}
+	if p.name == "" {
+		return nil, fmt.Errorf("no Go files in %s", dir)
+	}
+	return p, nil
+}
+
+func newComponent(name string, st *ast.StructType) *component {
+	c := &component{name: name}
+	for _, f := range st.Fields.List {
+		typ := f.Type
+		mapType := ""
+		if m, ok := typ.(*ast.MapType); ok {
+			typ = m.Value
+			mapType = types.ExprString(m)
+		}
+		ch, ok := typ.(*ast.ChanType)
+		if !ok {
+			continue
+		}
+		for _, n := range f.Names {
+			c.ports = append(c.ports, port{n.Name, ch.Dir, types.ExprString(ch.Value), mapType})
+		}
+	}
+	return c
+}
+
+// A `channel` is a channel that the generated code creates.
+type channel struct {
+	name     string
+	elem     string
+	capacity int
+}
+
+// A `binding` assigns a channel to a port of a node.
+type binding struct {
+	port  *port
+	index string
+	ch    *channel
+}
+
+type generator struct {
+	g        *graph.Graph
+	pkg      *pkg
+	capacity int
+	// Variable names in use.
+	used  map[string]bool
+	vars  map[string]string
+	chans []*channel
+	// Bindings by process.
+	bindings map[string][]binding
+	// The channels for the inports and outports.
+	exports []*channel
+	warn    func(format string, args ...interface{})
+}
+
+// `name` returns `base`, or `base` with a number appended if it is taken.
+func (gen *generator) name(base string) string {
+	name := base
+	for i := 2; gen.used[name] || gen.pkg.idents[name] || token.IsKeyword(name) || types.Universe.Lookup(name) != nil; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	gen.used[name] = true
+	return name
+}
+
+// `initials` abbreviates a process name the way `main()` does, for example
+// "wordCounter" to "wc".
+func initials(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if i == 0 || unicode.IsUpper(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+func lowerFirst(s string) string {
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+func upperFirst(s string) string {
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// `resolve` looks up the port of an endpoint and checks its direction.
+func (gen *generator) resolve(e graph.Endpoint, output bool) (*port, error) {
+	proc := gen.g.Process(e.Process)
+	comp := gen.pkg.components[proc.Component]
+	if comp == nil {
+		return nil, fmt.Errorf("process %s: no struct type %s in package %s", proc.Name, proc.Component, gen.pkg.name)
+	}
+	p := comp.port(e.Port)
+	switch {
+	case p == nil:
+		return nil, fmt.Errorf("%s: %s has no channel field %s", e, comp.name, e.Port)
+	case output && !p.output():
+		return nil, fmt.Errorf("%s is not an output port", e)
+	case !output && !p.input():
+		return nil, fmt.Errorf("%s is not an input port", e)
+	case p.mapType != "" && e.Index == "":
+		return nil, fmt.Errorf("%s needs a key, like %s[key]", e, e.Port)
+	case p.mapType == "" && e.Index != "":
+		return nil, fmt.Errorf("%s: %s is not a map of channels", e, e.Port)
+	}
+	return p, nil
+}
+
+func (gen *generator) newChannel(name, elem string, capacity int) *channel {
+	if capacity == 0 {
+		capacity = gen.capacity
+	}
+	// Channels that only signal, like `done`, need no buffer.
+	if elem == "struct{}" {
+		capacity = 0
+	}
+	ch := &channel{gen.name(name), elem, capacity}
+	gen.chans = append(gen.chans, ch)
+	return ch
+}
+
+func (gen *generator) bind(e graph.Endpoint, p *port, ch *channel) {
+	gen.bindings[e.Process] = append(gen.bindings[e.Process], binding{p, e.Index, ch})
+}
+
+func (gen *generator) plan() error {
+	for _, proc := range gen.g.Processes {
+		// Metadata like the routes of a router is read at run time, which
+		// generated code does not do; configure these nodes in code. What
+		// graph editors store, like positions, does not matter here.
+		if len(proc.Config()) > 0 {
+			return fmt.Errorf("process %s: fbpgen does not support metadata", proc.Name)
+		}
+		gen.vars[proc.Name] = gen.name(initials(proc.Name))
+	}
+	for _, e := range gen.g.Inports {
+		p, err := gen.resolve(e.Endpoint, false)
+		if err != nil {
+			return fmt.Errorf("inport %s: %v", e.Name, err)
+		}
+		ch := gen.newChannel(lowerFirst(e.Name), p.elem, 0)
+		gen.bind(e.Endpoint, p, ch)
+		gen.exports = append(gen.exports, ch)
+	}
+	for _, c := range gen.g.Connections {
+		src, err := gen.resolve(c.Src, true)
+		if err != nil {
+			return err
+		}
+		tgt, err := gen.resolve(c.Tgt, false)
+		if err != nil {
+			return err
+		}
+		// The channel gets the type of the sending port. If the receiving
+		// port has a different type, the generated code does not compile.
+		ch := gen.newChannel(gen.vars[c.Src.Process]+"To"+upperFirst(gen.vars[c.Tgt.Process]), src.elem, c.Capacity)
+		gen.bind(c.Src, src, ch)
+		gen.bind(c.Tgt, tgt, ch)
+	}
+	for _, e := range gen.g.Outports {
+		p, err := gen.resolve(e.Endpoint, true)
+		if err != nil {
+			return fmt.Errorf("outport %s: %v", e.Name, err)
+		}
+		ch := gen.newChannel(lowerFirst(e.Name), p.elem, 0)
+		gen.bind(e.Endpoint, p, ch)
+		gen.exports = append(gen.exports, ch)
+	}
+
+	for _, proc := range gen.g.Processes {
+		bound := map[string]bool{}
+		for _, b := range gen.bindings[proc.Name] {
+			bound[b.port.name] = true
+		}
+		for _, p := range gen.pkg.components[proc.Component].ports {
+			if !bound[p.name] && p.mapType == "" {
+				gen.warn("%s.%s is not connected", proc.Name, p.name)
+			}
+		}
+	}
+	return nil
+}
+
+// `generate` writes the wiring function, in the same layout as `main()`.
+func (gen *generator) generate(source, funcName string) ([]byte, error) {
+	if err := gen.plan(); err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by fbpgen from %s. DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(&b, "package %s\n\n", gen.pkg.name)
+
+	var results, names []string
+	for _, e := range gen.g.Inports {
+		results = append(results, "chan<- "+gen.exportChan(e.Name).elem)
+		names = append(names, e.Name)
+	}
+	for _, e := range gen.g.Outports {
+		results = append(results, "<-chan "+gen.exportChan(e.Name).elem)
+		names = append(names, e.Name)
+	}
+	fmt.Fprintf(&b, "// `%s` creates the nodes and channels of the network in\n", funcName)
+	fmt.Fprintf(&b, "// %s, connects them, and starts the nodes.", source)
+	if len(names) > 0 {
+		fmt.Fprintf(&b, "\n// It returns the network's ports %s.", strings.Join(names, ", "))
+	}
+	fmt.Fprintf(&b, "\nfunc %s() (%s) {\n", funcName, strings.Join(results, ", "))
+
+	b.WriteString("// Create the processor nodes.\n")
+	for _, proc := range gen.g.Processes {
+		var maps []string
+		for _, p := range gen.pkg.components[proc.Component].ports {
+			if p.mapType == "" {
+				continue
+			}
+			for _, bd := range gen.bindings[proc.Name] {
+				if bd.port.name == p.name {
+					maps = append(maps, fmt.Sprintf("%s: %s{}", p.name, p.mapType))
+					break
+				}
+			}
+		}
+		fmt.Fprintf(&b, "%s := &%s{%s}\n", gen.vars[proc.Name], proc.Component, strings.Join(maps, ", "))
+	}
+
+	b.WriteString("\n// Create the channels for the network.\n")
+	for _, ch := range gen.chans {
+		if ch.capacity == 0 {
+			fmt.Fprintf(&b, "%s := make(chan %s)\n", ch.name, ch.elem)
+		} else {
+			fmt.Fprintf(&b, "%s := make(chan %s, %d)\n", ch.name, ch.elem, ch.capacity)
+		}
+	}
+
+	b.WriteString("\n// Connect the nodes to each other.\n")
+	for i, proc := range gen.g.Processes {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		// Assign the ports in the order of the struct fields.
+		for _, p := range gen.pkg.components[proc.Component].ports {
+			for _, bd := range gen.bindings[proc.Name] {
+				if bd.port.name != p.name {
+					continue
+				}
+				if bd.index != "" {
+					fmt.Fprintf(&b, "%s.%s[%q] = %s\n", gen.vars[proc.Name], p.name, bd.index, bd.ch.name)
+				} else {
+					fmt.Fprintf(&b, "%s.%s = %s\n", gen.vars[proc.Name], p.name, bd.ch.name)
+				}
+			}
+		}
+	}
+
+	b.WriteString("\n// Start the nodes.\n")
+	for _, proc := range gen.g.Processes {
+		fmt.Fprintf(&b, "%s.Process()\n", gen.vars[proc.Name])
+	}
+	var ret []string
+	for _, ch := range gen.exports {
+		ret = append(ret, ch.name)
+	}
+	fmt.Fprintf(&b, "\nreturn %s\n}\n", strings.Join(ret, ", "))
+	return format.Source(b.Bytes())
+}
+
+func (gen *generator) exportChan(name string) *channel {
+	for i, e := range append(append([]graph.Export(nil), gen.g.Inports...), gen.g.Outports...) {
+		if e.Name == name {
+			return gen.exports[i]
+		}
+	}
+	return nil
+}
+
+// `generate` reads the graph at `source` and the package in `dir`, and
+// returns the generated code.
+func generate(source, dir, out, funcName string, capacity int, warn func(string, ...interface{})) ([]byte, error) {
+	g, err := graph.Load(source)
+	if err != nil {
+		return nil, err
+	}
+	p, err := loadPackage(dir, out)
+	if err != nil {
+		return nil, err
+	}
+	gen := &generator{
+		g:        g,
+		pkg:      p,
+		capacity: capacity,
+		used:     map[string]bool{},
+		vars:     map[string]string{},
+		bindings: map[string][]binding{},
+		warn:     warn,
+	}
+	return gen.generate(filepath.Base(source), funcName)
+}
+
+func main() {
+	funcName := flag.String("func", "newNet", "name of the generated function")
+	out := flag.String("o", "", "output file (default: the graph file name with _gen.go)")
+	capacity := flag.Int("capacity", 10, "default channel capacity")
+	dir := flag.String("dir", ".", "directory of the package that defines the nodes")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: fbpgen [flags] graph.fbp|graph.json")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	source := flag.Arg(0)
+	if *out == "" {
+		*out = strings.TrimSuffix(source, filepath.Ext(source)) + "_gen.go"
+	}
+
+	warn := func(format string, args ...interface{}) {
+		fmt.Fprintf(os.Stderr, "fbpgen: warning: "+format+"\n", args...)
+	}
+	src, err := generate(source, *dir, *out, *funcName, *capacity, warn)
+	if err == nil {
+		err = os.WriteFile(*out, src, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fbpgen:", err)
+		os.Exit(1)
+	}
+}
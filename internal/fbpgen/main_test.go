@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func noWarnings(t *testing.T) func(string, ...interface{}) {
+	return func(format string, args ...interface{}) {
+		t.Errorf("unexpected warning: "+format, args...)
+	}
+}
+
+// The generated code in the repository must match the graph definition.
+func TestCounterNetIsUpToDate(t *testing.T) {
+	root := filepath.Join("..", "..")
+	got, err := generate(filepath.Join(root, "counternet.fbp"), root, "counternet_gen.go", "newCounterNet", 10, noWarnings(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(filepath.Join(root, "counternet_gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("counternet_gen.go is out of date, run go generate:\n%s", got)
+	}
+}
+
+// A connection between ports of different types must not compile.
+func TestTypeMismatch(t *testing.T) {
+	dir := filepath.Join("testdata", "mismatch")
+	src, err := generate(filepath.Join(dir, "net.fbp"), dir, "net_gen.go", "newNet", 10, noWarnings(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	nodes, err := parser.ParseFile(fset, filepath.Join(dir, "nodes.go"), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, err := parser.ParseFile(fset, "net_gen.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: importer.Default()}
+	_, err = conf.Check("mismatch", fset, []*ast.File{nodes, gen}, nil)
+	if err == nil || !strings.Contains(err.Error(), "cannot use sToS") {
+		t.Errorf("got %v, want a type error for the channel sToS", err)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join("..", "..")
+	for _, tt := range []struct{ fbp, err string }{
+		{"s(splitter) Out3 -> Sentence wc(wordCounter)", "splitter has no channel field Out3"},
+		{"s(splitter) In -> Sentence wc(wordCounter)", "s.In is not an output port"},
+		{"s(splitter) Out1 -> Count wc(wordCounter)", "wc.Count is not an input port"},
+		{"s(splitter) Out1 -> Sentence x(nothing)", "no struct type nothing"},
+		{"r(router) Out -> Sentence wc(wordCounter)", "r.Out needs a key"},
+		{"s(splitter) Out1[x] -> Sentence wc(wordCounter)", "Out1 is not a map of channels"},
+		{"r(router:routes=r.json) Default -> Sentence wc(wordCounter)", "process r: fbpgen does not support metadata"},
+	} {
+		path := filepath.Join(dir, "net.fbp")
+		if err := os.WriteFile(path, []byte(tt.fbp), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := generate(path, root, "net_gen.go", "newNet", 10, func(string, ...interface{}) {})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: got error %v, want %q", tt.fbp, err, tt.err)
+		}
+	}
+
+	// Positions and labels from graph editors configure nothing.
+	path := filepath.Join(dir, "net.fbp")
+	if err := os.WriteFile(path, []byte("s(splitter:x=10,y=20,label=Split) Out1 -> Sentence wc(wordCounter)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := generate(path, root, "net_gen.go", "newNet", 10, func(string, ...interface{}) {}); err != nil {
+		t.Errorf("editor metadata: got error %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+package mismatch
+
+type source struct {
+	Out chan<- int
+}
+
+func (s *source) Process() {}
+
+type sink struct {
+	In <-chan string
+}
+
+func (s *sink) Process() {}
@@ -0,0 +1,12 @@
+// `fbpvet` runs the `wiring` analyzer, either on its own or through
+// `go vet -vettool`. See package `wiring` for what it reports.
+package main
+
+import (
+	"github.com/appliedgo/flow2go/internal/wiring"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(wiring.Analyzer)
+}
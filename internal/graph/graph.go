@@ -0,0 +1,427 @@
+// Package graph reads network definitions, so that networks can be written
+// down as data rather than as wiring code. It understands two formats:
+//
+// A subset of the FBP language of NoFlo and other FBP systems. Each line
+// connects the output port of one process to the input port of the next,
+// and names the component (the node type) when a process first appears:
+//
+//	INPORT=splitter.In:In
+//	OUTPORT=printer.Done:Done
+//	splitter(splitter) Out1 -> Sentence wordCounter(wordCounter) Count -> Line1 printer(printer)
+//	splitter Out2 -> Sentence letterCounter(letterCounter) Count -> Line2 printer
+//
+// Ports of map fields, like the outputs of `router`, take the key in
+// brackets: `router Out[questions] -> Sentence wc`. Processes can carry
+// metadata after the component, as comma-separated key=value pairs:
+// `router(router:routes=routes.json)`. Lines starting with `#` are comments.
+//
+// The JSON graph format of NoFlo, with an optional capacity per connection:
+//
+//	{
+//	  "processes": {"splitter": {"component": "splitter"},
+//	                "router": {"component": "router", "metadata": {"routes": "routes.json"}}},
+//	  "connections": [{"src": {"process": "splitter", "port": "Out1"},
+//	                   "tgt": {"process": "wordCounter", "port": "Sentence"},
+//	                   "capacity": 10}],
+//	  "inports": {"In": {"process": "splitter", "port": "In"}},
+//	  "outports": {"Done": {"process": "printer", "port": "Done"}}
+//	}
+package graph
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A `Graph` is a network definition. All lists keep the order of the
+// definition.
+type Graph struct {
+	Processes   []Process
+	Connections []Connection
+	// Inports and outports are the ports of the network itself, each mapped
+	// to a port of a process.
+	Inports  []Export
+	Outports []Export
+}
+
+// A `Process` is a node of the network.
+type Process struct {
+	Name string
+	// The node type, for example "splitter".
+	Component string
+	// Settings for the node, like the file that a `router` reads its routes
+	// from. What the keys mean is up to the component, except for the keys
+	// that graph editors use; see `Config`.
+	Metadata map[string]string
+}
+
+// `editorKeys` are the metadata keys that graph editors like noflo-ui and
+// Flowhub store for themselves, such as the position of a process on the
+// canvas.
+var editorKeys = map[string]bool{"x": true, "y": true, "width": true, "height": true, "label": true, "icon": true}
+
+// `Config` returns the metadata without the editor keys, or nil if nothing
+// else is left. This is the part of the metadata that configures the node.
+func (p Process) Config() map[string]string {
+	var cfg map[string]string
+	for k, v := range p.Metadata {
+		if editorKeys[k] {
+			continue
+		}
+		if cfg == nil {
+			cfg = map[string]string{}
+		}
+		cfg[k] = v
+	}
+	return cfg
+}
+
+// An `Endpoint` is a port of a process.
+type Endpoint struct {
+	Process string `json:"process"`
+	Port    string `json:"port"`
+	// The key for ports of map fields, like "questions" in
+	// `Out[questions]`.
+	Index string `json:"index,omitempty"`
+}
+
+func (e Endpoint) String() string {
+	s := e.Process + "." + e.Port
+	if e.Index != "" {
+		s += "[" + e.Index + "]"
+	}
+	return s
+}
+
+// A `Connection` is an edge from an output port to an input port.
+type Connection struct {
+	Src Endpoint `json:"src"`
+	Tgt Endpoint `json:"tgt"`
+	// The capacity of the channel, or zero for the default capacity.
+	Capacity int `json:"capacity,omitempty"`
+}
+
+// An `Export` maps a port of the network to a port of a process.
+type Export struct {
+	Name string
+	Endpoint
+}
+
+// `Process` returns the process with the given name, or nil.
+func (g *Graph) Process(name string) *Process {
+	for i := range g.Processes {
+		if g.Processes[i].Name == name {
+			return &g.Processes[i]
+		}
+	}
+	return nil
+}
+
+// `Validate` checks that every endpoint refers to a known process, and that
+// every port is used only once. A port with two connections would need a
+// channel with two writers or two readers; use a `splitter` or a node with
+// two input ports instead.
+func (g *Graph) Validate() error {
+	used := map[string]string{}
+	use := func(e Endpoint, what string) error {
+		if g.Process(e.Process) == nil {
+			return fmt.Errorf("%s: unknown process %s", what, e.Process)
+		}
+		if other, ok := used[e.String()]; ok {
+			return fmt.Errorf("%s: port %s is already used by %s", what, e, other)
+		}
+		used[e.String()] = what
+		return nil
+	}
+	for _, p := range g.Processes {
+		if p.Component == "" {
+			return fmt.Errorf("process %s has no component", p.Name)
+		}
+	}
+	for _, c := range g.Connections {
+		if err := use(c.Src, "connection "+c.Src.String()+" -> "+c.Tgt.String()); err != nil {
+			return err
+		}
+		if err := use(c.Tgt, "connection "+c.Src.String()+" -> "+c.Tgt.String()); err != nil {
+			return err
+		}
+	}
+	for _, e := range g.Inports {
+		if err := use(e.Endpoint, "inport "+e.Name); err != nil {
+			return err
+		}
+	}
+	for _, e := range g.Outports {
+		if err := use(e.Endpoint, "outport "+e.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// `Load` reads a graph from a file, in JSON format if the file name ends in
+// ".json" and in FBP format otherwise, and validates it.
+func Load(path string) (*Graph, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var g *Graph
+	if filepath.Ext(path) == ".json" {
+		g, err = ParseJSON(f)
+	} else {
+		g, err = ParseFBP(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := g.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return g, nil
+}
+
+var (
+	processSpec = regexp.MustCompile(`^(\w+)(?:\((\w+)(?::([^()]*))?\))?$`)
+	portSpec    = regexp.MustCompile(`^(\w+)(?:\[(\w+)\])?$`)
+	exportSpec  = regexp.MustCompile(`^(INPORT|OUTPORT)=(\w+)\.(\w+)(?:\[(\w+)\])?:(\w+)$`)
+)
+
+// `ParseFBP` reads a graph in FBP format.
+func ParseFBP(r io.Reader) (*Graph, error) {
+	g := &Graph{}
+	// `process` returns the name of the process in a spec like
+	// "splitter(splitter)" and adds the process when it first appears.
+	process := func(spec string) (string, error) {
+		m := processSpec.FindStringSubmatch(spec)
+		if m == nil {
+			return "", fmt.Errorf("invalid process %q", spec)
+		}
+		meta, err := parseMetadata(m[3])
+		if err != nil {
+			return "", fmt.Errorf("process %s: %v", m[1], err)
+		}
+		p := g.Process(m[1])
+		switch {
+		case p == nil:
+			g.Processes = append(g.Processes, Process{m[1], m[2], meta})
+			return m[1], nil
+		case m[2] != "" && p.Component == "":
+			p.Component = m[2]
+		case m[2] != "" && m[2] != p.Component:
+			return "", fmt.Errorf("process %s is a %s, not a %s", m[1], p.Component, m[2])
+		}
+		for k, v := range meta {
+			if old, ok := p.Metadata[k]; ok && old != v {
+				return "", fmt.Errorf("process %s has %s=%s already", m[1], k, old)
+			}
+			if p.Metadata == nil {
+				p.Metadata = map[string]string{}
+			}
+			p.Metadata[k] = v
+		}
+		return m[1], nil
+	}
+	endpoint := func(proc, spec string) (Endpoint, error) {
+		m := portSpec.FindStringSubmatch(spec)
+		if m == nil {
+			return Endpoint{}, fmt.Errorf("invalid port %q", spec)
+		}
+		return Endpoint{proc, m[1], m[2]}, nil
+	}
+
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+		for _, stmt := range splitStatements(text) {
+			if err := parseStatement(g, stmt, process, endpoint); err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+		}
+	}
+	return g, s.Err()
+}
+
+// `splitStatements` splits a line at the commas that are not part of the
+// metadata of a process.
+func splitStatements(line string) []string {
+	var stmts []string
+	depth, start := 0, 0
+	for i, r := range line {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				stmts = append(stmts, line[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(stmts, line[start:])
+}
+
+// `parseMetadata` reads metadata like "routes=routes.json,limit=3".
+func parseMetadata(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	meta := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid metadata %q (want key=value)", kv)
+		}
+		meta[k] = v
+	}
+	return meta, nil
+}
+
+func parseStatement(g *Graph, stmt string, process func(string) (string, error), endpoint func(string, string) (Endpoint, error)) error {
+	stmt = strings.TrimSpace(stmt)
+	if stmt == "" {
+		return nil
+	}
+	if m := exportSpec.FindStringSubmatch(stmt); m != nil {
+		e := Export{m[5], Endpoint{m[2], m[3], m[4]}}
+		if m[1] == "INPORT" {
+			g.Inports = append(g.Inports, e)
+		} else {
+			g.Outports = append(g.Outports, e)
+		}
+		return nil
+	}
+	if strings.HasPrefix(stmt, "'") {
+		return fmt.Errorf("initial packets are not supported")
+	}
+
+	// A chain has the form `proc PORT -> PORT proc PORT -> PORT proc`.
+	tokens := strings.Fields(strings.ReplaceAll(stmt, "->", " -> "))
+	if len(tokens) < 5 || (len(tokens)-1)%4 != 0 {
+		return fmt.Errorf("invalid connection %q", stmt)
+	}
+	src, err := process(tokens[0])
+	if err != nil {
+		return err
+	}
+	for i := 1; i < len(tokens); i += 4 {
+		if tokens[i+1] != "->" {
+			return fmt.Errorf("expected -> instead of %q", tokens[i+1])
+		}
+		tgt, err := process(tokens[i+3])
+		if err != nil {
+			return err
+		}
+		out, err := endpoint(src, tokens[i])
+		if err != nil {
+			return err
+		}
+		in, err := endpoint(tgt, tokens[i+2])
+		if err != nil {
+			return err
+		}
+		g.Connections = append(g.Connections, Connection{Src: out, Tgt: in})
+		src = tgt
+	}
+	return nil
+}
+
+// `jsonGraph` is the JSON format. Processes and ports are JSON objects, so
+// their order is read separately.
+type jsonGraph struct {
+	Processes   json.RawMessage `json:"processes"`
+	Connections []Connection    `json:"connections"`
+	Inports     json.RawMessage `json:"inports"`
+	Outports    json.RawMessage `json:"outports"`
+}
+
+// `ParseJSON` reads a graph in JSON format.
+func ParseJSON(r io.Reader) (*Graph, error) {
+	var jg jsonGraph
+	if err := json.NewDecoder(r).Decode(&jg); err != nil {
+		return nil, err
+	}
+	g := &Graph{Connections: jg.Connections}
+
+	var procs map[string]struct {
+		Component string                     `json:"component"`
+		Metadata  map[string]json.RawMessage `json:"metadata"`
+	}
+	names, err := objectKeys(jg.Processes, &procs)
+	if err != nil {
+		return nil, fmt.Errorf("processes: %v", err)
+	}
+	for _, name := range names {
+		p := Process{Name: name, Component: procs[name].Component}
+		// Editors store things like the position of a process in the
+		// metadata, too, so values need not be strings.
+		for k, raw := range procs[name].Metadata {
+			var v string
+			if json.Unmarshal(raw, &v) != nil {
+				v = string(raw)
+			}
+			if p.Metadata == nil {
+				p.Metadata = map[string]string{}
+			}
+			p.Metadata[k] = v
+		}
+		g.Processes = append(g.Processes, p)
+	}
+
+	for _, ports := range []struct {
+		raw  json.RawMessage
+		list *[]Export
+		what string
+	}{{jg.Inports, &g.Inports, "inports"}, {jg.Outports, &g.Outports, "outports"}} {
+		var m map[string]Endpoint
+		names, err := objectKeys(ports.raw, &m)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", ports.what, err)
+		}
+		for _, name := range names {
+			*ports.list = append(*ports.list, Export{name, m[name]})
+		}
+	}
+	return g, nil
+}
+
+// `objectKeys` decodes a JSON object into `v` and returns its keys in the
+// order they appear. A missing object has no keys.
+func objectKeys(raw json.RawMessage, v interface{}) ([]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	var keys []string
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, t.(string))
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
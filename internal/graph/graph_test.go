@@ -0,0 +1,172 @@
+package graph
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const counterFBP = `
+# The counter network.
+INPORT=splitter.In:In
+OUTPORT=printer.Done:Done
+splitter(splitter) Out1 -> Sentence wordCounter(wordCounter) Count -> Line1 printer(printer)
+splitter Out2->Sentence letterCounter(letterCounter), letterCounter Count -> Line2 printer
+`
+
+const counterJSON = `{
+  "processes": {
+    "splitter": {"component": "splitter"},
+    "wordCounter": {"component": "wordCounter"},
+    "printer": {"component": "printer"},
+    "letterCounter": {"component": "letterCounter"}
+  },
+  "connections": [
+    {"src": {"process": "splitter", "port": "Out1"}, "tgt": {"process": "wordCounter", "port": "Sentence"}},
+    {"src": {"process": "wordCounter", "port": "Count"}, "tgt": {"process": "printer", "port": "Line1"}},
+    {"src": {"process": "splitter", "port": "Out2"}, "tgt": {"process": "letterCounter", "port": "Sentence"}},
+    {"src": {"process": "letterCounter", "port": "Count"}, "tgt": {"process": "printer", "port": "Line2"}}
+  ],
+  "inports": {"In": {"process": "splitter", "port": "In"}},
+  "outports": {"Done": {"process": "printer", "port": "Done"}}
+}`
+
+func TestFormatsAgree(t *testing.T) {
+	fbp, err := ParseFBP(strings.NewReader(counterFBP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := ParseJSON(strings.NewReader(counterJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fbp, js) {
+		t.Errorf("FBP and JSON differ:\n%+v\n%+v", fbp, js)
+	}
+	if err := fbp.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseFBP(t *testing.T) {
+	g, err := ParseFBP(strings.NewReader("r(router) Out[questions] -> Sentence wc(wordCounter)"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Connection{Src: Endpoint{"r", "Out", "questions"}, Tgt: Endpoint{"wc", "Sentence", ""}}
+	if len(g.Connections) != 1 || g.Connections[0] != want {
+		t.Errorf("got %+v, want %+v", g.Connections, want)
+	}
+
+	for _, tt := range []struct{ fbp, err string }{
+		{"a(x) Out -> In", "invalid connection"},
+		{"a(x) Out => In b(y)", "expected ->"},
+		{"a(x) Out -> In b(y)\na(z) Out2 -> In c(y)", "line 2: process a is a x, not a z"},
+		{"'hello' -> In a(x)", "initial packets"},
+		{"a(x:oops) Out -> In b(y)", "invalid metadata \"oops\""},
+		{"a(x:k=1) Out -> In b(y)\na(x:k=2) Out2 -> In c(y)", "process a has k=1 already"},
+	} {
+		if _, err := ParseFBP(strings.NewReader(tt.fbp)); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: got error %v, want %q", tt.fbp, err, tt.err)
+		}
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	fbp, err := ParseFBP(strings.NewReader("r(router:routes=routes.json,x=12) Out[q] -> Sentence wc(wordCounter), r Default -> Sentence lc(letterCounter)"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := ParseJSON(strings.NewReader(`{
+  "processes": {
+    "r": {"component": "router", "metadata": {"routes": "routes.json", "x": 12}},
+    "wc": {"component": "wordCounter"},
+    "lc": {"component": "letterCounter"}
+  },
+  "connections": [
+    {"src": {"process": "r", "port": "Out", "index": "q"}, "tgt": {"process": "wc", "port": "Sentence"}},
+    {"src": {"process": "r", "port": "Default"}, "tgt": {"process": "lc", "port": "Sentence"}}
+  ]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"routes": "routes.json", "x": "12"}
+	if got := fbp.Process("r").Metadata; !reflect.DeepEqual(got, want) {
+		t.Errorf("got metadata %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(fbp, js) {
+		t.Errorf("FBP and JSON differ:\n%+v\n%+v", fbp, js)
+	}
+	// The position is for editors, not for the node.
+	if got, want := js.Process("r").Config(), map[string]string{"routes": "routes.json"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got config %v, want %v", got, want)
+	}
+	if got := js.Process("wc").Config(); got != nil {
+		t.Errorf("got config %v for a process without metadata", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range []struct{ fbp, err string }{
+		{"a(x) Out -> In b(y)\na Out -> In c(y)", "port a.Out is already used"},
+		{"a(x) Out -> In b(y)\nc(y) Out -> In b", "port b.In is already used"},
+		{"INPORT=z.In:In\na(x) Out -> In b(y)", "unknown process z"},
+		{"a Out -> In b(y)", "process a has no component"},
+	} {
+		g, err := ParseFBP(strings.NewReader(tt.fbp))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := g.Validate(); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: got error %v, want %q", tt.fbp, err, tt.err)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	g, err := ParseFBP(strings.NewReader("INPORT=s.In:In\nOUTPORT=p.Done:Done\ns(splitter) Out1 -> Line1 p(printer)\nr(router) Out[questions] -> Line2 p"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{FormatDot, `digraph {
+	rankdir=LR;
+	node [shape=box];
+	"s" [label="s\n(splitter)"];
+	"p" [label="p\n(printer)"];
+	"r" [label="r\n(router)"];
+	"in:In" [label="In", shape=oval];
+	"in:In" -> "s" [label="In"];
+	"s" -> "p" [label="Out1 → Line1"];
+	"r" -> "p" [label="Out[questions] → Line2"];
+	"out:Done" [label="Done", shape=oval];
+	"p" -> "out:Done" [label="Done"];
+}
+`},
+		{FormatMermaid, `flowchart LR
+	p0["s<br>(splitter)"]
+	p1["p<br>(printer)"]
+	p2["r<br>(router)"]
+	in0(["In"]) -- "In" --> p0
+	p0 -- "Out1 → Line1" --> p1
+	p2 -- "Out[questions] → Line2" --> p1
+	p1 -- "Done" --> out0(["Done"])
+`},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		if err := g.Render(&b, tt.format); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.format, b.String(), tt.want)
+		}
+	}
+	if err := g.Render(&strings.Builder{}, "svg"); err == nil {
+		t.Error("Render accepted an unknown format")
+	}
+}
@@ -0,0 +1,83 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The diagram formats that `Render` can write.
+const (
+	// Graphviz, for `dot -Tsvg`.
+	FormatDot = "dot"
+	// Mermaid flowcharts, which GitHub renders in Markdown files.
+	FormatMermaid = "mermaid"
+)
+
+// `Render` writes the graph as a diagram: one box per process, labeled with
+// its name and component, and one arrow per connection, labeled with the
+// ports. The network's inports and outports appear as rounded boxes.
+func (g *Graph) Render(w io.Writer, format string) error {
+	var b strings.Builder
+	switch format {
+	case FormatDot:
+		g.dot(&b)
+	case FormatMermaid:
+		g.mermaid(&b)
+	default:
+		return fmt.Errorf("unknown diagram format %q (want %s or %s)", format, FormatDot, FormatMermaid)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// `portLabel` is the label of a connection, like "Out1 → Sentence".
+func portLabel(src, tgt Endpoint) string {
+	return strings.TrimPrefix(src.String(), src.Process+".") + " → " + strings.TrimPrefix(tgt.String(), tgt.Process+".")
+}
+
+func (g *Graph) dot(b *strings.Builder) {
+	q := strconv.Quote
+	b.WriteString("digraph {\n\trankdir=LR;\n\tnode [shape=box];\n")
+	for _, p := range g.Processes {
+		fmt.Fprintf(b, "\t%s [label=%s];\n", q(p.Name), q(p.Name+"\n("+p.Component+")"))
+	}
+	for _, e := range g.Inports {
+		fmt.Fprintf(b, "\t%s [label=%s, shape=oval];\n", q("in:"+e.Name), q(e.Name))
+		fmt.Fprintf(b, "\t%s -> %s [label=%s];\n", q("in:"+e.Name), q(e.Process), q(strings.TrimPrefix(e.Endpoint.String(), e.Process+".")))
+	}
+	for _, c := range g.Connections {
+		fmt.Fprintf(b, "\t%s -> %s [label=%s];\n", q(c.Src.Process), q(c.Tgt.Process), q(portLabel(c.Src, c.Tgt)))
+	}
+	for _, e := range g.Outports {
+		fmt.Fprintf(b, "\t%s [label=%s, shape=oval];\n", q("out:"+e.Name), q(e.Name))
+		fmt.Fprintf(b, "\t%s -> %s [label=%s];\n", q(e.Process), q("out:"+e.Name), q(strings.TrimPrefix(e.Endpoint.String(), e.Process+".")))
+	}
+	b.WriteString("}\n")
+}
+
+func (g *Graph) mermaid(b *strings.Builder) {
+	// Mermaid node IDs must be plain words, so number the processes.
+	ids := map[string]string{}
+	for i, p := range g.Processes {
+		ids[p.Name] = "p" + strconv.Itoa(i)
+	}
+	// Quotes inside labels must be escaped as entities.
+	label := func(s string) string {
+		return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+	}
+	b.WriteString("flowchart LR\n")
+	for _, p := range g.Processes {
+		fmt.Fprintf(b, "\t%s[%s]\n", ids[p.Name], label(p.Name+"<br>("+p.Component+")"))
+	}
+	for i, e := range g.Inports {
+		fmt.Fprintf(b, "\tin%d([%s]) -- %s --> %s\n", i, label(e.Name), label(strings.TrimPrefix(e.Endpoint.String(), e.Process+".")), ids[e.Process])
+	}
+	for _, c := range g.Connections {
+		fmt.Fprintf(b, "\t%s -- %s --> %s\n", ids[c.Src.Process], label(portLabel(c.Src, c.Tgt)), ids[c.Tgt.Process])
+	}
+	for i, e := range g.Outports {
+		fmt.Fprintf(b, "\t%s -- %s --> out%d([%s])\n", ids[e.Process], label(strings.TrimPrefix(e.Endpoint.String(), e.Process+".")), i, label(e.Name))
+	}
+}
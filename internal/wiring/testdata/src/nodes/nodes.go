@@ -0,0 +1,183 @@
+package nodes
+
+type splitter struct {
+	In         <-chan string
+	Out1, Out2 chan<- string
+}
+
+func (s *splitter) Process() {
+	go func() {
+		for v := range s.In {
+			s.Out1 <- v
+			s.Out2 <- v
+		}
+		close(s.Out1)
+		close(s.Out2)
+	}()
+}
+
+type leaky struct {
+	In         <-chan string
+	Out1, Out2 chan<- string
+}
+
+func (l *leaky) Process() { // want "leaky.Process does not close output Out2"
+	go func() {
+		for v := range l.In {
+			l.Out1 <- v
+			l.Out2 <- v
+		}
+		close(l.Out1)
+	}()
+}
+
+// `router` closes its map of outputs in a loop, and `Default` in a helper
+// method.
+type router struct {
+	In      <-chan string
+	Out     map[string]chan<- string
+	Default chan<- string
+}
+
+func (r *router) Process() {
+	go func() {
+		for v := range r.In {
+			r.Default <- v
+		}
+		for _, out := range r.Out {
+			close(out)
+		}
+		r.finish()
+	}()
+}
+
+func (r *router) finish() {
+	close(r.Default)
+}
+
+type forgetsReturn struct {
+	In  <-chan string
+	Out chan<- string
+}
+
+func (f *forgetsReturn) Process() {
+	go func() {
+		for {
+			v, ok := <-f.In
+			if !ok {
+				close(f.Out)
+			}
+			f.Out <- v // want "send on f.Out after it may have been closed"
+		}
+	}()
+}
+
+type sink struct {
+	In <-chan string
+}
+
+func (s *sink) Process() {}
+
+func fanIn() {
+	in := make(chan string)
+	out := make(chan string)
+	a := &splitter{In: in, Out1: out, Out2: make(chan string)}
+	b := &splitter{}
+	b.Out1 = out // want "out is the output of both splitter.Out1 and splitter.Out1"
+	a.Process()
+	b.Process()
+}
+
+func samePorts(in chan string) {
+	ch := make(chan string)
+	_ = &splitter{In: in, Out1: ch, Out2: ch} // want "ch is the output of both splitter.Out1 and splitter.Out2"
+}
+
+func branches(word bool) {
+	out := make(chan string)
+	if word {
+		_ = &leaky{Out1: out}
+	} else {
+		_ = &splitter{Out1: out}
+	}
+}
+
+func loop(in chan string) {
+	for i := 0; i < 3; i++ {
+		out1, out2 := make(chan string), make(chan string)
+		(&splitter{In: in, Out1: out1, Out2: out2}).Process()
+		in = out1
+	}
+}
+
+func routes() {
+	r := &router{Out: map[string]chan<- string{}}
+	q := make(chan string)
+	r.Out["questions"] = q
+	r.Default = q // want "q is the output of both router.Out\\[\"questions\"\\] and router.Default"
+}
+
+func deferred(values []string, out chan<- string) {
+	defer close(out)
+	for _, v := range values {
+		out <- v
+	}
+}
+
+// `counter` closes its output in a function that gets the channel as an
+// argument, and `relayed` through a second function.
+type counter struct {
+	In    <-chan string
+	Count chan<- int
+}
+
+func (c *counter) Process() {
+	go countEach(c.In, c.Count)
+}
+
+func countEach(in <-chan string, out chan<- int) {
+	for s := range in {
+		out <- len(s)
+	}
+	close(out)
+}
+
+type relayed struct {
+	In    <-chan string
+	Count chan<- int
+}
+
+func (r *relayed) Process() {
+	go func() {
+		relay(r.In, r.Count)
+	}()
+}
+
+func relay(in <-chan string, out chan<- int) {
+	countEach(in, out)
+}
+
+// `forwarder` passes its output to a function that does not close it.
+type forwarder struct {
+	In    <-chan string
+	Count chan<- int
+}
+
+func (f *forwarder) Process() { // want "forwarder.Process does not close output Count"
+	go forward(f.In, f.Count)
+}
+
+func forward(in <-chan string, out chan<- int) {
+	for s := range in {
+		out <- len(s)
+	}
+}
+
+// Each iteration closes a channel of its own.
+func closeEach(n int) {
+	for i := 0; i < n; i++ {
+		ch := make(chan int, 1)
+		ch <- i
+		close(ch)
+	}
+}
@@ -0,0 +1,543 @@
+// Package wiring provides an analyzer that finds the wiring mistakes that
+// flow-based programs in pure Go are prone to. A node is a struct with a
+// `Process()` method, and its output ports are the fields of type `chan<-`,
+// or maps of them.
+//
+// The analyzer reports
+//
+//   - `Process()` methods that never close one of the node's outputs, so
+//     that the nodes downstream never shut down (closes in other methods of
+//     the node, and in functions of the package that get the output as an
+//     argument, count),
+//   - channels that are the output of more than one node, or of more than
+//     one port, which panic when the second writer closes them (this is why
+//     the printer in the article has two input channels), and
+//   - sends on a channel after a path that closes it, typically a missing
+//     `return` after closing the outputs.
+//
+// To run it through `go vet`, build the `fbpvet` command:
+//
+//	go build -o fbpvet ./internal/fbpvet
+//	go vet -vettool=$(pwd)/fbpvet ./...
+package wiring
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/cfg"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name: "wiring",
+	Doc:  "check flow-based networks for outputs that are not closed, outputs with several writers, and sends after close",
+	Run:  run,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch fn := n.(type) {
+			case *ast.FuncDecl:
+				if fn.Body == nil {
+					return false
+				}
+				if node := processReceiver(pass, fn); node != nil {
+					checkCloses(pass, fn, node)
+				}
+				checkBody(pass, fn.Body)
+			case *ast.FuncLit:
+				checkBody(pass, fn.Body)
+			}
+			return true
+		})
+	}
+	return nil, nil
+}
+
+// `isNode` reports whether `t` is a node type, that is, whether `*t` has a
+// `Process()` method.
+func isNode(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	if _, ok := named.Underlying().(*types.Struct); !ok {
+		return false
+	}
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(named), true, named.Obj().Pkg(), "Process")
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := fn.Type().(*types.Signature)
+	return sig.Params().Len() == 0 && sig.Results().Len() == 0
+}
+
+// `nodeOf` returns the node type of `t` or `*t`, or nil.
+func nodeOf(t types.Type) *types.Named {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	if isNode(t) {
+		return t.(*types.Named)
+	}
+	return nil
+}
+
+// `isOutput` reports whether a field of a node is an output port, or a map
+// of output ports.
+func isOutput(t types.Type) bool {
+	if m, ok := t.Underlying().(*types.Map); ok {
+		t = m.Elem()
+	}
+	ch, ok := t.Underlying().(*types.Chan)
+	return ok && ch.Dir() == types.SendOnly
+}
+
+// `processReceiver` returns the node type if `fn` is the `Process()` method
+// of a node.
+func processReceiver(pass *analysis.Pass, fn *ast.FuncDecl) *types.Named {
+	if fn.Recv == nil || fn.Name.Name != "Process" || len(fn.Recv.List[0].Names) == 0 {
+		return nil
+	}
+	obj := pass.TypesInfo.Defs[fn.Recv.List[0].Names[0]]
+	if obj == nil {
+		return nil
+	}
+	return nodeOf(obj.Type())
+}
+
+// `checkCloses` reports the outputs of a node that `Process()` never closes,
+// neither directly nor through other methods of the node, nor through
+// functions of the package that get the output as an argument.
+func checkCloses(pass *analysis.Pass, fn *ast.FuncDecl, node *types.Named) {
+	methods := map[string]*ast.FuncDecl{}
+	funcs := map[types.Object]*ast.FuncDecl{}
+	for _, f := range pass.Files {
+		for _, d := range f.Decls {
+			m, ok := d.(*ast.FuncDecl)
+			if !ok || m.Body == nil {
+				continue
+			}
+			if m.Recv == nil {
+				funcs[pass.TypesInfo.Defs[m.Name]] = m
+				continue
+			}
+			if len(m.Recv.List[0].Names) > 0 {
+				if obj := pass.TypesInfo.Defs[m.Recv.List[0].Names[0]]; obj != nil && nodeOf(obj.Type()) == node {
+					methods[m.Name.Name] = m
+				}
+			}
+		}
+	}
+	// `callee` returns the function of the package that `call` calls.
+	callee := func(call *ast.CallExpr) *ast.FuncDecl {
+		if id, ok := ast.Unparen(call.Fun).(*ast.Ident); ok {
+			return funcs[pass.TypesInfo.Uses[id]]
+		}
+		return nil
+	}
+
+	type param struct {
+		f *ast.FuncDecl
+		i int
+	}
+	closesParams := map[param]bool{}
+	// `closesParam` reports whether `f` closes its parameter at index `i`,
+	// directly or by passing it on to another function of the package.
+	var closesParam func(f *ast.FuncDecl, i int) bool
+	closesParam = func(f *ast.FuncDecl, i int) bool {
+		if closes, ok := closesParams[param{f, i}]; ok {
+			return closes
+		}
+		// Recursive calls do not close the parameter unless the rest of
+		// the function does.
+		closesParams[param{f, i}] = false
+		var obj types.Object
+		j := 0
+		for _, field := range f.Type.Params.List {
+			for _, name := range field.Names {
+				if j == i {
+					obj = pass.TypesInfo.Defs[name]
+				}
+				j++
+			}
+		}
+		if obj == nil {
+			return false
+		}
+		isParam := func(e ast.Expr) bool {
+			id, ok := ast.Unparen(e).(*ast.Ident)
+			return ok && pass.TypesInfo.Uses[id] == obj
+		}
+		closes := false
+		ast.Inspect(f.Body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || closes {
+				return !closes
+			}
+			if isBuiltin(pass, call.Fun, "close") && len(call.Args) == 1 && isParam(call.Args[0]) {
+				closes = true
+			} else if g := callee(call); g != nil {
+				for k, arg := range call.Args {
+					if isParam(arg) && closesParam(g, k) {
+						closes = true
+					}
+				}
+			}
+			return !closes
+		})
+		closesParams[param{f, i}] = closes
+		return closes
+	}
+
+	closed := map[string]bool{}
+	visited := map[string]bool{}
+	var visit func(m *ast.FuncDecl)
+	visit = func(m *ast.FuncDecl) {
+		if visited[m.Name.Name] {
+			return
+		}
+		visited[m.Name.Name] = true
+		recv := pass.TypesInfo.Defs[m.Recv.List[0].Names[0]]
+		// `field` returns the name of the receiver's field that `e` refers
+		// to, like "Out" in `t.Out` or `t.Out["x"]`.
+		field := func(e ast.Expr) string {
+			if ix, ok := ast.Unparen(e).(*ast.IndexExpr); ok {
+				e = ix.X
+			}
+			sel, ok := ast.Unparen(e).(*ast.SelectorExpr)
+			if !ok {
+				return ""
+			}
+			if id, ok := sel.X.(*ast.Ident); ok && pass.TypesInfo.Uses[id] == recv {
+				return sel.Sel.Name
+			}
+			return ""
+		}
+		// Variables that range over a map of outputs, like `out` in
+		// `for _, out := range t.Out`.
+		ranged := map[types.Object]string{}
+		// `port` returns the output field that `e` refers to, either
+		// directly or through a variable in `ranged`.
+		port := func(e ast.Expr) string {
+			if f := field(e); f != "" {
+				return f
+			}
+			if id, ok := ast.Unparen(e).(*ast.Ident); ok {
+				return ranged[pass.TypesInfo.Uses[id]]
+			}
+			return ""
+		}
+		ast.Inspect(m.Body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.RangeStmt:
+				if id, ok := n.Value.(*ast.Ident); ok {
+					if f := field(n.X); f != "" {
+						ranged[pass.TypesInfo.Defs[id]] = f
+					}
+				}
+			case *ast.CallExpr:
+				if isBuiltin(pass, n.Fun, "close") && len(n.Args) == 1 {
+					if f := port(n.Args[0]); f != "" {
+						closed[f] = true
+					}
+				}
+				if g := callee(n); g != nil {
+					for i, arg := range n.Args {
+						if f := port(arg); f != "" && closesParam(g, i) {
+							closed[f] = true
+						}
+					}
+				}
+				if sel, ok := n.Fun.(*ast.SelectorExpr); ok {
+					if id, ok := sel.X.(*ast.Ident); ok && pass.TypesInfo.Uses[id] == recv {
+						if callee, ok := methods[sel.Sel.Name]; ok {
+							visit(callee)
+						}
+					}
+				}
+			}
+			return true
+		})
+	}
+	visit(fn)
+
+	st := node.Underlying().(*types.Struct)
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		if isOutput(f.Type()) && !closed[f.Name()] {
+			pass.Reportf(fn.Name.Pos(), "%s.Process does not close output %s", node.Obj().Name(), f.Name())
+		}
+	}
+}
+
+func isBuiltin(pass *analysis.Pass, fun ast.Expr, name string) bool {
+	id, ok := ast.Unparen(fun).(*ast.Ident)
+	if !ok {
+		return false
+	}
+	b, ok := pass.TypesInfo.Uses[id].(*types.Builtin)
+	return ok && b.Name() == name
+}
+
+// `checkBody` looks for sends after close and for outputs with several
+// writers in a function body. Function literals inside the body are checked
+// on their own.
+func checkBody(pass *analysis.Pass, body *ast.BlockStmt) {
+	g := cfg.New(body, func(call *ast.CallExpr) bool {
+		return !isBuiltin(pass, call.Fun, "panic")
+	})
+	checkSendAfterClose(pass, g)
+	checkWriters(pass, g)
+}
+
+// `inspectNode` walks a CFG node without descending into function literals.
+func inspectNode(n ast.Node, f func(ast.Node)) {
+	ast.Inspect(n, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FuncLit); ok {
+			return false
+		}
+		if n != nil {
+			f(n)
+		}
+		return true
+	})
+}
+
+// `after` calls `f` for every CFG node that can execute after the node at
+// index `i` of block `b`, until `f` returns false for a node.
+func after(b *cfg.Block, i int, f func(ast.Node) bool) {
+	for _, n := range b.Nodes[i+1:] {
+		if !f(n) {
+			return
+		}
+	}
+	seen := map[*cfg.Block]bool{}
+	queue := append([]*cfg.Block(nil), b.Succs...)
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		stop := false
+		for _, n := range s.Nodes {
+			if !f(n) {
+				stop = true
+				break
+			}
+		}
+		if !stop {
+			queue = append(queue, s.Succs...)
+		}
+	}
+}
+
+func checkSendAfterClose(pass *analysis.Pass, g *cfg.CFG) {
+	reported := map[token.Pos]bool{}
+	for _, b := range g.Blocks {
+		if !b.Live {
+			continue
+		}
+		for i, n := range b.Nodes {
+			// A deferred close runs at the very end.
+			if _, ok := n.(*ast.DeferStmt); ok {
+				continue
+			}
+			inspectNode(n, func(n ast.Node) {
+				call, ok := n.(*ast.CallExpr)
+				if !ok || !isBuiltin(pass, call.Fun, "close") || len(call.Args) != 1 {
+					return
+				}
+				ch := types.ExprString(ast.Unparen(call.Args[0]))
+				root := rootVar(pass, call.Args[0])
+				after(b, i, func(n ast.Node) bool {
+					// A variable that is declared again, like a
+					// variable inside a loop, holds a new channel.
+					if root != nil && declares(pass, n, root) {
+						return false
+					}
+					inspectNode(n, func(n ast.Node) {
+						if send, ok := n.(*ast.SendStmt); ok && types.ExprString(ast.Unparen(send.Chan)) == ch && !reported[send.Pos()] {
+							reported[send.Pos()] = true
+							pass.Reportf(send.Pos(), "send on %s after it may have been closed", ch)
+						}
+					})
+					return true
+				})
+			})
+		}
+	}
+}
+
+// `rootVar` returns the variable that an expression like `ch`, `n.Out`, or
+// `e.In()` starts with, or nil.
+func rootVar(pass *analysis.Pass, e ast.Expr) types.Object {
+	for {
+		switch x := ast.Unparen(e).(type) {
+		case *ast.Ident:
+			if v, ok := pass.TypesInfo.Uses[x].(*types.Var); ok {
+				return v
+			}
+			return nil
+		case *ast.SelectorExpr:
+			e = x.X
+		case *ast.IndexExpr:
+			e = x.X
+		case *ast.CallExpr:
+			e = x.Fun
+		case *ast.StarExpr:
+			e = x.X
+		default:
+			return nil
+		}
+	}
+}
+
+// An `output` is the assignment of a channel to an output port.
+type output struct {
+	ch   string
+	port string
+	// The variable that holds the channel, if any.
+	obj types.Object
+}
+
+// `outputs` returns the channels that `n` assigns to output ports of nodes,
+// in assignments like `s.Out1 = ch` or `r.Out["x"] = ch`, and in composite
+// literals like `&splitter{Out1: ch}`.
+func outputs(pass *analysis.Pass, n ast.Node) []output {
+	var outs []output
+	add := func(port string, ch ast.Expr) {
+		ch = ast.Unparen(ch)
+		o := output{ch: types.ExprString(ch), port: port}
+		if id, ok := ch.(*ast.Ident); ok {
+			if id.Name == "nil" {
+				return
+			}
+			o.obj = pass.TypesInfo.Uses[id]
+		}
+		outs = append(outs, o)
+	}
+	// `port` names the output port that `lhs` refers to, or returns an
+	// empty string.
+	port := func(lhs ast.Expr) string {
+		suffix := ""
+		if ix, ok := lhs.(*ast.IndexExpr); ok {
+			lhs = ix.X
+			suffix = "[" + types.ExprString(ix.Index) + "]"
+		}
+		sel, ok := lhs.(*ast.SelectorExpr)
+		if !ok {
+			return ""
+		}
+		s, ok := pass.TypesInfo.Selections[sel]
+		if !ok || s.Kind() != types.FieldVal || !isOutput(s.Obj().Type()) {
+			return ""
+		}
+		node := nodeOf(s.Recv())
+		if node == nil {
+			return ""
+		}
+		return node.Obj().Name() + "." + sel.Sel.Name + suffix
+	}
+	inspectNode(n, func(n ast.Node) {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if len(n.Lhs) != len(n.Rhs) {
+				return
+			}
+			for i, lhs := range n.Lhs {
+				if p := port(lhs); p != "" {
+					add(p, n.Rhs[i])
+				}
+			}
+		case *ast.CompositeLit:
+			node := nodeOf(pass.TypesInfo.TypeOf(n))
+			if node == nil {
+				return
+			}
+			st := node.Underlying().(*types.Struct)
+			for _, elt := range n.Elts {
+				kv, ok := elt.(*ast.KeyValueExpr)
+				if !ok {
+					continue
+				}
+				key, ok := kv.Key.(*ast.Ident)
+				if !ok {
+					continue
+				}
+				for i := 0; i < st.NumFields(); i++ {
+					if f := st.Field(i); f.Name() == key.Name && isOutput(f.Type()) {
+						add(node.Obj().Name()+"."+key.Name, kv.Value)
+					}
+				}
+			}
+		}
+	})
+	return outs
+}
+
+// `same` reports whether two outputs get the same channel.
+func (o output) same(p output) bool {
+	if o.obj != nil || p.obj != nil {
+		return o.obj == p.obj
+	}
+	return o.ch == p.ch
+}
+
+// `checkWriters` reports channels that become the output of a second port
+// after they are already the output of another one. A variable that is
+// declared again in between, like a variable inside a loop, holds a new
+// channel.
+func checkWriters(pass *analysis.Pass, g *cfg.CFG) {
+	reported := map[token.Pos]bool{}
+	report := func(n ast.Node, first, second output) {
+		if reported[n.Pos()] {
+			return
+		}
+		reported[n.Pos()] = true
+		pass.Reportf(n.Pos(), "%s is the output of both %s and %s; the first one to close it makes the other panic", second.ch, first.port, second.port)
+	}
+	for _, b := range g.Blocks {
+		if !b.Live {
+			continue
+		}
+		for i, n := range b.Nodes {
+			outs := outputs(pass, n)
+			for j, first := range outs {
+				for _, second := range outs[j+1:] {
+					if first.same(second) {
+						report(n, first, second)
+					}
+				}
+				after(b, i, func(n ast.Node) bool {
+					if first.obj != nil && declares(pass, n, first.obj) {
+						return false
+					}
+					for _, second := range outputs(pass, n) {
+						if first.same(second) {
+							report(n, first, second)
+						}
+					}
+					return true
+				})
+			}
+		}
+	}
+}
+
+// `declares` reports whether `n` declares `obj`.
+func declares(pass *analysis.Pass, n ast.Node, obj types.Object) bool {
+	found := false
+	inspectNode(n, func(n ast.Node) {
+		if id, ok := n.(*ast.Ident); ok && pass.TypesInfo.Defs[id] == obj {
+			found = true
+		}
+	})
+	return found
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// `track` records the goroutines that a node has just started, for example
+// the goroutine of `Process()` and the goroutines of `printer.merge()`:
+// the new goroutines that the goroutine `caller`, which called `Process()`,
+// has started, and the goroutines that these have started in turn. `before`
+// holds the IDs of the goroutines that existed before, like the goroutines
+// of the edges. Goroutines that the nodes start later are found by `adopt`.
+// The caller must hold `n.mu`.
+func (n *network) track(node string, caller int, before map[int]bool) {
+	gs := goroutines()
+	for _, g := range gs {
+		if g.Parent == caller && !before[g.ID] {
+			n.launched[g.ID] = node
+		}
+	}
+	n.adopt(gs)
+}
+
+// `goroutineIDs` returns the IDs of all goroutines of the process.
+func goroutineIDs() map[int]bool {
+	ids := map[int]bool{}
+	for _, g := range goroutines() {
+		ids[g.ID] = true
+	}
+	return ids
+}
+
+// A `leakError` lists the goroutines of a network that did not exit.
+type leakError struct {
+	Leaks []nodeDiagnosis
+}
+
+func (e *leakError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d goroutines did not exit:", len(e.Leaks))
+	for _, l := range e.Leaks {
+		fmt.Fprintf(&b, "\n  %s (%s): %s", l.Node, l.Func, l.State)
+		if len(l.Ports) > 0 {
+			fmt.Fprintf(&b, " on %s", strings.Join(l.Ports, ", "))
+		}
+	}
+	return b.String()
+}
+
+// `Wait` waits until every goroutine that the nodes started through `Start`
+// has exited, which happens after the network's input has been closed and
+// the shutdown has propagated through all nodes. If goroutines are still
+// running after `timeout`, `Wait` returns a `*leakError` that lists them.
+//
+// A goroutine usually leaks because a node upstream forgot to close one of
+// its outputs, so for goroutines that wait for input, the error also lists
+// the input edges that are still open and probably keep them waiting.
+func (n *network) Wait(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		leaks := n.leaks()
+		if len(leaks) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return &leakError{leaks}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// `leaks` returns the tracked goroutines that are still running.
+func (n *network) leaks() []nodeDiagnosis {
+	gs := goroutines()
+	links := n.links()
+	alive := map[int]bool{}
+	for _, g := range gs {
+		alive[g.ID] = true
+	}
+	// Forget the goroutines that have exited.
+	n.mu.Lock()
+	n.adopt(gs)
+	launched := map[int]string{}
+	for id, node := range n.launched {
+		if alive[id] {
+			launched[id] = node
+		} else {
+			delete(n.launched, id)
+		}
+	}
+	n.mu.Unlock()
+
+	var leaks []nodeDiagnosis
+	for _, g := range gs {
+		node, ok := launched[g.ID]
+		if !ok {
+			continue
+		}
+		_, method := g.NodeType()
+		l := nodeDiagnosis{Node: node, Func: method, State: g.State}
+		for _, e := range links {
+			from, to := e.Endpoints()
+			switch {
+			case to.Node == node && g.blockedOnChannel() && g.State != "chan send" && !e.closed():
+				l.Ports = append(l.Ports, fmt.Sprintf("%s (%s still open)", to.Port, e.Name()))
+			case from.Node == node && g.State != "chan receive":
+				if s := e.Stats(); s.Len == s.Cap {
+					l.Ports = append(l.Ports, fmt.Sprintf("%s (%s %d/%d)", from.Port, s.Name, s.Len, s.Cap))
+				}
+			}
+		}
+		leaks = append(leaks, l)
+	}
+	return leaks
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWait(t *testing.T) {
+	_, restore := captureStdout(t)
+	defer restore()
+	n := newNetwork()
+	in, done := buildCounterNet(n, 2)
+	in <- "Life is too important to be taken seriously."
+	close(in)
+	if err := n.Wait(time.Second); err != nil {
+		t.Error(err)
+	}
+	<-done
+}
+
+// `forgetful` counts words like `wordCounter`, but forgets to close its
+// output.
+type forgetful struct {
+	Sentence <-chan string
+	Count    chan<- *count
+}
+
+func (f *forgetful) Process() {
+	go func() {
+		for s := range f.Sentence {
+			f.Count <- &count{"Words", len(strings.Fields(s)), 1}
+		}
+	}()
+}
+
+func TestWaitReportsLeaks(t *testing.T) {
+	_, restore := captureStdout(t)
+	defer restore()
+	n := newNetwork()
+	in := newEdge[string](n, "in", 1).Connect("", "In", "forgetful", "Sentence")
+	fToP := newEdge[*count](n, "fToP", 1).Connect("forgetful", "Count", "printer", "Line1")
+	none := newEdge[*count](n, "none", 1).Connect("", "None", "printer", "Line2")
+	close(none.In())
+	n.Start("forgetful", &forgetful{Sentence: in.Out(), Count: fToP.In()})
+	done := make(chan struct{})
+	n.Start("printer", &printer{Line1: fToP.Out(), Line2: none.Out(), Done: done})
+	in.In() <- "Why?"
+	close(in.In())
+
+	err := n.Wait(50 * time.Millisecond)
+	// Let the printer finish, so that its goroutines do not leak into other
+	// tests.
+	defer func() {
+		close(fToP.In())
+		<-done
+	}()
+	if err == nil {
+		t.Fatal("Wait did not report the leaked goroutines")
+	}
+	leaks := err.(*leakError).Leaks
+	if len(leaks) != 3 {
+		t.Errorf("Wait reported %d leaks, want the printer's three goroutines:\n%v", len(leaks), err)
+	}
+	for _, l := range leaks {
+		if l.Node != "printer" {
+			t.Errorf("Wait reported a leak in %s, want printer", l.Node)
+		}
+	}
+	if !strings.Contains(err.Error(), "Line1 (fToP still open)") {
+		t.Errorf("Wait did not name the open edge:\n%v", err)
+	}
+}
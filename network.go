@@ -0,0 +1,346 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// The interface that unites all node structs, as in the interface version of
+// this code.
+type processor interface {
+	Process()
+}
+
+// A `port` is a named input or output of a node.
+type port struct {
+	Node, Port string
+}
+
+func (p port) String() string {
+	if p.Node == "" {
+		return p.Port
+	}
+	return p.Node + "." + p.Port
+}
+
+// `link` is what the network needs to know about an edge, regardless of the
+// type of packets that flow through it.
+type link interface {
+	Name() string
+	Endpoints() (from, to port)
+	Stats() edgeStats
+	addTap(t *tap)
+	removeTap(t *tap)
+	// `closed` reports whether the producer has closed the edge.
+	closed() bool
+	// `collect` and `deliver` move packets in deterministic mode.
+	collect(wait bool) bool
+	deliver(wait bool) bool
+}
+
+// `network` keeps track of the nodes and of the instrumented edges between
+// them. The nodes themselves are wired exactly as in `main()`, except that the
+// channels come from `newEdge` rather than from `make`, and the nodes are
+// started through `Start`.
+type network struct {
+	mu        sync.Mutex
+	edges     []link
+	nodes     []string
+	nodeTypes map[string]string
+	traffic   map[string]*nodeTraffic
+	tracer    *tracer
+	clock     clock
+	// `sched` is set in deterministic mode.
+	sched *scheduler
+	// The goroutines started by the nodes, and the nodes that started them.
+	launched map[int]string
+}
+
+func newNetwork() *network {
+	return &network{
+		nodeTypes: map[string]string{},
+		traffic:   map[string]*nodeTraffic{},
+		clock:     realClock{},
+		launched:  map[int]string{},
+	}
+}
+
+// `Clock` returns the clock that the network's edges use for their
+// timestamps. Time-based nodes should use it, too.
+func (n *network) Clock() clock {
+	return n.clock
+}
+
+// `Start` registers a node under the given name and calls its `Process()`
+// method. It keeps track of the goroutines that `Process()` starts, so that
+// `Wait` can check that they exit.
+func (n *network) Start(name string, p processor) {
+	typ := strings.TrimPrefix(fmt.Sprintf("%T", p), "*main.")
+	n.mu.Lock()
+	n.node(name)
+	n.nodeTypes[name] = typ
+	n.mu.Unlock()
+	caller, before := currentGoroutine(), goroutineIDs()
+	p.Process()
+	n.mu.Lock()
+	n.track(name, caller, before)
+	n.mu.Unlock()
+}
+
+func (n *network) add(l link) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.edges = append(n.edges, l)
+}
+
+// `links` returns all edges.
+func (n *network) links() []link {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]link(nil), n.edges...)
+}
+
+// `edge` returns the edge with the given name, or nil.
+func (n *network) edge(name string) link {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, e := range n.edges {
+		if e.Name() == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// `EdgeStats` returns a snapshot of every edge, in the order the edges were
+// created.
+func (n *network) EdgeStats() []edgeStats {
+	edges := n.links()
+	stats := make([]edgeStats, 0, len(edges))
+	for _, e := range edges {
+		stats = append(stats, e.Stats())
+	}
+	return stats
+}
+
+// `nodeTraffic` accumulates the traffic of a single node, as seen by the
+// edges around it.
+type nodeTraffic struct {
+	received, sent uint64
+	// When the node took the packets it has not answered yet.
+	pending []time.Time
+	latency *histogram
+}
+
+// Sink nodes never answer, so the list of pending packets must be bounded.
+const maxPending = 1024
+
+// `nodeStats` is a snapshot of the traffic of a single node.
+type nodeStats struct {
+	Name string
+	// Type of the node struct, or empty if the node was not started
+	// through `Start`.
+	Type string
+	// Packets the node has taken from its input edges, and packets it has
+	// put into its output edges.
+	Received, Sent uint64
+	// Time between taking a packet from an input edge and sending the next
+	// packet to an output edge. The input edge accounts for a packet right
+	// after the node has taken it, so when a node answers faster than that,
+	// the answer is not measured.
+	Latency histogram
+}
+
+// `node` returns the traffic record of a node, creating it if necessary.
+// The caller must hold `n.mu`.
+func (n *network) node(name string) *nodeTraffic {
+	t, ok := n.traffic[name]
+	if !ok {
+		t = &nodeTraffic{latency: newHistogram(latencyBuckets)}
+		n.traffic[name] = t
+		n.nodes = append(n.nodes, name)
+	}
+	return t
+}
+
+// `received` is called by an edge when a node has taken a packet from it.
+// `tc` and `enqueued` are the trace context of the packet and the time it
+// entered the edge.
+func (n *network) received(to port, edge string, at time.Time, tc traceContext, enqueued time.Time) {
+	if to.Node == "" {
+		return
+	}
+	n.mu.Lock()
+	t := n.node(to.Node)
+	t.received++
+	if len(t.pending) == maxPending {
+		t.pending = t.pending[1:]
+	}
+	t.pending = append(t.pending, at)
+	tr := n.tracer
+	n.mu.Unlock()
+
+	if tr != nil {
+		var outs []string
+		if n.linked(to.Node) {
+			outs = n.outputs(to.Node)
+		}
+		tr.received(to, edge, at, tc, enqueued, outs)
+	}
+}
+
+// `linked` reports whether the tracer links the packets that `node` sends
+// to the packets it takes.
+func (n *network) linked(node string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return oneToOne[n.nodeTypes[node]]
+}
+
+// `outputs` returns the names of the edges that start at `node`.
+func (n *network) outputs(node string) []string {
+	var outs []string
+	for _, e := range n.links() {
+		if from, _ := e.Endpoints(); from.Node == node {
+			outs = append(outs, e.Name())
+		}
+	}
+	return outs
+}
+
+// `sent` is called by an edge when a node has put a packet into the edge,
+// and returns the trace context for the packet. If the node has a pending input
+// packet, the time since taking that packet counts as processing latency.
+// (Nodes with more than one output, like `splitter`, only report the latency
+// of their first output.)
+func (n *network) sent(node, edge string, at time.Time) traceContext {
+	n.mu.Lock()
+	if node != "" {
+		t := n.node(node)
+		t.sent++
+		if len(t.pending) > 0 {
+			t.latency.Observe(at.Sub(t.pending[0]).Seconds())
+			t.pending = t.pending[1:]
+		}
+	}
+	tr := n.tracer
+	n.mu.Unlock()
+
+	if tr == nil {
+		return traceContext{}
+	}
+	if !n.linked(node) {
+		// The packet starts a new trace, like a packet from outside.
+		node = ""
+	}
+	return tr.sent(node, edge, at)
+}
+
+// `NodeStats` returns a snapshot of every node, in the order the nodes were
+// first seen.
+func (n *network) NodeStats() []nodeStats {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	stats := make([]nodeStats, 0, len(n.nodes))
+	for _, name := range n.nodes {
+		t := n.traffic[name]
+		stats = append(stats, nodeStats{
+			Name:     name,
+			Type:     n.nodeTypes[name],
+			Received: t.received,
+			Sent:     t.sent,
+			Latency:  t.latency.clone(),
+		})
+	}
+	return stats
+}
+
+// `Monitor` calls `f` with a snapshot of all edges every `interval` on the
+// network's clock, until the returned `stop` function is called.
+func (n *network) Monitor(interval time.Duration, f func([]edgeStats)) (stop func()) {
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	c := n.Clock()
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-observeAfter(c, interval):
+				f(n.EdgeStats())
+			case <-quit:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(quit)
+			<-done
+		})
+	}
+}
+
+// `printEdgeStats` writes edge snapshots as an aligned table.
+func printEdgeStats(w io.Writer, stats []edgeStats) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "edge\tsent\treceived\tlen\tcap\tblocked\tidle\t")
+	for _, s := range stats {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%v\t%v\t\n",
+			s.Name, s.Sent, s.Received, s.Len, s.Cap,
+			s.Blocked.Round(time.Microsecond), s.Idle.Round(time.Microsecond))
+	}
+	return tw.Flush()
+}
+
+// `buildCounterNet` wires up the same network as `main()`, but with
+// instrumented edges. It returns the network's input channel and the channel
+// that `printer` closes when the network has shut down.
+func buildCounterNet(n *network, capacity int) (chan<- string, <-chan struct{}) {
+	s := &splitter{}
+	wc := &wordCounter{}
+	lc := &letterCounter{}
+	p := &printer{}
+
+	in := newEdge[string](n, "in", capacity).
+		Connect("", "In", "splitter", "In")
+	sToWc := newEdge[string](n, "sToWc", capacity).
+		Connect("splitter", "Out1", "wordCounter", "Sentence")
+	sToLc := newEdge[string](n, "sToLc", capacity).
+		Connect("splitter", "Out2", "letterCounter", "Sentence")
+	wcToP := newEdge[*count](n, "wcToP", capacity).
+		Connect("wordCounter", "Count", "printer", "Line1")
+	lcToP := newEdge[*count](n, "lcToP", capacity).
+		Connect("letterCounter", "Count", "printer", "Line2")
+	done := make(chan struct{})
+
+	s.In = in.Out()
+	s.Out1 = sToWc.In()
+	s.Out2 = sToLc.In()
+
+	wc.Sentence = sToWc.Out()
+	wc.Count = wcToP.In()
+
+	lc.Sentence = sToLc.Out()
+	lc.Count = lcToP.In()
+
+	p.Line1 = wcToP.Out()
+	p.Line2 = lcToP.Out()
+	p.Done = done
+
+	n.Start("splitter", s)
+	n.Start("wordCounter", wc)
+	n.Start("letterCounter", lc)
+	n.Start("printer", p)
+
+	return in.In(), done
+}
+
+// `newCounterNet` in counternet_gen.go wires up the same network as `main()`,
+// with plain channels, from the graph definition in counternet.fbp.
+//
+//go:generate go run ./internal/fbpgen -func newCounterNet counternet.fbp
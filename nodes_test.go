@@ -0,0 +1,70 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+	"unicode"
+)
+
+func TestNodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     processor
+		in, want ports
+	}{
+		{"splitter copies to both outputs", &splitter{},
+			ports{"In": {"a", "b"}},
+			ports{"Out1": {"a", "b"}, "Out2": {"a", "b"}}},
+		{"splitter without input", &splitter{},
+			ports{},
+			ports{"Out1": nil, "Out2": nil}},
+		{"wordCounter", &wordCounter{},
+			ports{"Sentence": {"Life is too important to be taken seriously."}},
+			ports{"Count": {&count{"Words", 8, 1}}}},
+		{"wordCounter with empty sentence", &wordCounter{},
+			ports{"Sentence": {""}},
+			ports{"Count": {&count{"Words", 0, 1}}}},
+		{"wordCounter with tokenizer", &wordCounter{Tokenize: wordBoundaries},
+			ports{"Sentence": {"Don't panic - it's only 3.14!"}},
+			ports{"Count": {&count{"Words", 5, 1}}}},
+		{"letterCounter", &letterCounter{},
+			ports{"Sentence": {"Life is too important to be taken seriously."}},
+			ports{"Count": {&count{"Letters", 36, 1}}}},
+		{"letterCounter with umlauts and Cyrillic", &letterCounter{},
+			ports{"Sentence": {"Größe, Жизнь 42!"}},
+			ports{"Count": {&count{"Letters", 10, 1}}}},
+		{"letterCounter with classes", &letterCounter{Classes: []*unicode.RangeTable{unicode.Digit, unicode.Punct}},
+			ports{"Sentence": {"Größe, Жизнь 42!"}},
+			ports{"Count": {&count{"Letters", 4, 1}}}},
+		{"letterCounter with script", &letterCounter{Classes: []*unicode.RangeTable{unicode.Cyrillic}},
+			ports{"Sentence": {"Größe, Жизнь 42!"}},
+			ports{"Count": {&count{"Letters", 5, 1}}}},
+		{"letterCounter with pattern", &letterCounter{Pattern: regexp.MustCompile("[a-zA-Z]")},
+			ports{"Sentence": {"Größe, Жизнь 42!"}},
+			ports{"Count": {&count{"Letters", 3, 1}}}},
+		{"printer", &printer{},
+			ports{"Line1": {&count{"Words", 8, 1}}},
+			ports{"stdout": {"Printer starts.", "Words: 8", "Printer has finished."}}},
+		{"printer with scaled count", &printer{},
+			ports{"Line1": {&count{"Flesch-Kincaid grade", -340, 100}}},
+			ports{"stdout": {"Printer starts.", "Flesch-Kincaid grade: -3.40", "Printer has finished."}}},
+		{"router", &router{Out: map[string]chan<- string{"questions": nil}, routes: []route{{"questions", isQuestion}}},
+			ports{"In": {"Why?", "Because."}},
+			ports{"Out[questions]": {"Why?"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expect(t, tt.node, tt.in, tt.want)
+		})
+	}
+}
+
+func TestLetterCounterAllocs(t *testing.T) {
+	lc := &letterCounter{Classes: []*unicode.RangeTable{unicode.Letter, unicode.Digit}}
+	allocs := testing.AllocsPerRun(100, func() {
+		lc.letters("Fashion is a form of ugliness so intolerable that we have to alter it every six months.")
+	})
+	if allocs != 0 {
+		t.Errorf("letterCounter allocates %v times per sentence, want 0", allocs)
+	}
+}
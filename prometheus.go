@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Upper bounds of the latency buckets, in seconds. Our nodes are fast, so
+// the buckets start at one microsecond.
+var latencyBuckets = []float64{1e-6, 1e-5, 1e-4, 1e-3, 1e-2, 1e-1, 1}
+
+// `histogram` counts observations in buckets, the way Prometheus expects
+// them. `Counts` has one more element than `Bounds`, for the observations
+// above the last bound.
+type histogram struct {
+	Bounds []float64
+	Counts []uint64
+	Sum    float64
+	Count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{
+		Bounds: bounds,
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h *histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.Bounds, v)
+	h.Counts[i]++
+	h.Sum += v
+	h.Count++
+}
+
+func (h *histogram) clone() histogram {
+	c := *h
+	c.Counts = append([]uint64(nil), h.Counts...)
+	return c
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// `labels` formats label pairs like `{node="printer",state="select"}`.
+func labels(kv ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, kv[i], labelEscaper.Replace(kv[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// `WritePrometheus` writes the metrics of all nodes, node goroutines and
+// edges of the network in the Prometheus text exposition format.
+func (n *network) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	nodes := n.NodeStats()
+	metric("flow2go_node_packets_received_total", "counter", "Packets a node has taken from its input edges.")
+	for _, s := range nodes {
+		fmt.Fprintf(bw, "flow2go_node_packets_received_total%s %d\n", labels("node", s.Name), s.Received)
+	}
+	metric("flow2go_node_packets_sent_total", "counter", "Packets a node has put into its output edges.")
+	for _, s := range nodes {
+		fmt.Fprintf(bw, "flow2go_node_packets_sent_total%s %d\n", labels("node", s.Name), s.Sent)
+	}
+	metric("flow2go_node_processing_seconds", "histogram", "Time from taking an input packet to sending the next output packet.")
+	for _, s := range nodes {
+		var cum uint64
+		for i, b := range s.Latency.Bounds {
+			cum += s.Latency.Counts[i]
+			fmt.Fprintf(bw, "flow2go_node_processing_seconds_bucket%s %d\n", labels("node", s.Name, "le", formatFloat(b)), cum)
+		}
+		fmt.Fprintf(bw, "flow2go_node_processing_seconds_bucket%s %d\n", labels("node", s.Name, "le", "+Inf"), s.Latency.Count)
+		fmt.Fprintf(bw, "flow2go_node_processing_seconds_sum%s %s\n", labels("node", s.Name), formatFloat(s.Latency.Sum))
+		fmt.Fprintf(bw, "flow2go_node_processing_seconds_count%s %d\n", labels("node", s.Name), s.Latency.Count)
+	}
+
+	// Goroutines are grouped by the node type and method that started them,
+	// and by their current state.
+	type goroutineKey struct{ typ, method, state string }
+	counts := map[goroutineKey]int{}
+	var keys []goroutineKey
+	for _, g := range n.nodeGoroutines() {
+		typ, method := g.NodeType()
+		k := goroutineKey{typ, method, g.State}
+		if counts[k] == 0 {
+			keys = append(keys, k)
+		}
+		counts[k]++
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.typ != b.typ {
+			return a.typ < b.typ
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.state < b.state
+	})
+	metric("flow2go_node_goroutines", "gauge", "Goroutines started by nodes, by node type, starting method and state.")
+	for _, k := range keys {
+		fmt.Fprintf(bw, "flow2go_node_goroutines%s %d\n", labels("node_type", k.typ, "func", k.method, "state", k.state), counts[k])
+	}
+
+	edges := n.EdgeStats()
+	metric("flow2go_edge_queue_length", "gauge", "Packets currently buffered in an edge.")
+	for _, s := range edges {
+		fmt.Fprintf(bw, "flow2go_edge_queue_length%s %d\n", labels("edge", s.Name), s.Len)
+	}
+	metric("flow2go_edge_capacity", "gauge", "Buffer capacity of an edge.")
+	for _, s := range edges {
+		fmt.Fprintf(bw, "flow2go_edge_capacity%s %d\n", labels("edge", s.Name), s.Cap)
+	}
+	metric("flow2go_edge_packets_sent_total", "counter", "Packets put into an edge.")
+	for _, s := range edges {
+		fmt.Fprintf(bw, "flow2go_edge_packets_sent_total%s %d\n", labels("edge", s.Name), s.Sent)
+	}
+	metric("flow2go_edge_packets_received_total", "counter", "Packets taken out of an edge.")
+	for _, s := range edges {
+		fmt.Fprintf(bw, "flow2go_edge_packets_received_total%s %d\n", labels("edge", s.Name), s.Received)
+	}
+	metric("flow2go_edge_blocked_seconds_total", "counter", "Time the producer was blocked on sends to a full edge.")
+	for _, s := range edges {
+		fmt.Fprintf(bw, "flow2go_edge_blocked_seconds_total%s %s\n", labels("edge", s.Name), formatFloat(s.Blocked.Seconds()))
+	}
+	metric("flow2go_edge_idle_seconds_total", "counter", "Time an edge was empty.")
+	for _, s := range edges {
+		fmt.Fprintf(bw, "flow2go_edge_idle_seconds_total%s %s\n", labels("edge", s.Name), formatFloat(s.Idle.Seconds()))
+	}
+	return bw.Flush()
+}
+
+// `MetricsHandler` serves the network's metrics to Prometheus.
+func (n *network) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		n.WritePrometheus(w)
+	})
+}
+
+// `ServeMetrics` starts an HTTP server that serves the metrics at
+// `/metrics`. Use an address like "localhost:0" to let the system pick a
+// free port; the returned server's `Addr` contains the actual address.
+func (n *network) ServeMetrics(addr string) (*http.Server, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot serve metrics: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", n.MetricsHandler())
+	srv := &http.Server{Addr: l.Addr().String(), Handler: mux}
+	go srv.Serve(l)
+	return srv, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	sampleLine  = regexp.MustCompile(`^(\w+)(\{[^}]*\})? [-+.\deInf]+$`)
+	commentLine = regexp.MustCompile(`^# (HELP|TYPE) (\w+) .+$`)
+)
+
+func TestServeMetrics(t *testing.T) {
+	_, restore := captureStdout(t)
+	defer restore()
+
+	// A second network of the same node types keeps running while the
+	// first one is scraped, and must not show up in its metrics.
+	other := newNetwork()
+	otherIn, otherDone := buildCounterNet(other, 2)
+	defer func() {
+		close(otherIn)
+		<-otherDone
+	}()
+
+	n := newNetwork()
+	in, done := buildCounterNet(n, 2)
+	for _, s := range []string{"Why?", "Because.", "Life is too important to be taken seriously."} {
+		in <- s
+	}
+	close(in)
+	<-done
+	if err := n.Wait(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the printer has received all counts", func() bool {
+		received := uint64(0)
+		for _, s := range n.EdgeStats() {
+			if s.Name == "wcToP" || s.Name == "lcToP" {
+				received += s.Received
+			}
+		}
+		return received == 6
+	})
+
+	srv, err := n.ServeMetrics("localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	resp, err := http.Get("http://" + srv.Addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("got content type %q", ct)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(b)
+
+	// Every sample belongs to a metric that has been declared before.
+	declared := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+		if m := commentLine.FindStringSubmatch(line); m != nil {
+			declared[m[2]] = true
+			continue
+		}
+		m := sampleLine.FindStringSubmatch(line)
+		if m == nil {
+			t.Errorf("invalid line %q", line)
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(m[1], "_bucket"), "_sum"), "_count")
+		if !declared[name] {
+			t.Errorf("%s has no HELP and TYPE before its samples", m[1])
+		}
+	}
+
+	for _, want := range []string{
+		"# TYPE flow2go_node_packets_received_total counter\n",
+		`flow2go_node_packets_received_total{node="printer"} 6` + "\n",
+		`flow2go_node_packets_sent_total{node="splitter"} 6` + "\n",
+		"# TYPE flow2go_node_processing_seconds histogram\n",
+		`flow2go_node_processing_seconds_bucket{node="wordCounter",le="+Inf"} `,
+		`flow2go_edge_capacity{edge="sToWc"} 2` + "\n",
+		`flow2go_edge_packets_sent_total{edge="in"} 3` + "\n",
+		`flow2go_edge_packets_received_total{edge="lcToP"} 3` + "\n",
+		`flow2go_edge_queue_length{edge="wcToP"} 0` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q", want)
+		}
+	}
+	// The network has shut down, so none of its goroutines are left, even
+	// though the other network's nodes are still running.
+	if strings.Contains(body, "flow2go_node_goroutines{") {
+		t.Errorf("metrics count goroutines of another network:\n%s", body)
+	}
+	var b2 strings.Builder
+	if err := other.WritePrometheus(&b2); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b2.String(), `flow2go_node_goroutines{node_type="printer",func="merge",state="chan receive"} 2`) {
+		t.Errorf("metrics of the running network lack the printer's goroutines:\n%s", b2.String())
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A recording is either a JSON Lines file, which is easy to read and edit,
+// or a gob stream, which is more compact.
+type recordFormat int
+
+const (
+	recordJSON recordFormat = iota
+	recordGob
+)
+
+// A `record` is a single packet that passed an edge.
+type record struct {
+	Edge   string          `json:"edge"`
+	At     time.Time       `json:"at"`
+	Packet json.RawMessage `json:"packet"`
+}
+
+// `recorder` is a tap sink that writes every packet to a recording.
+type recorder struct {
+	format recordFormat
+	w      *bufio.Writer
+	enc    interface{ Encode(interface{}) error }
+
+	mu  sync.Mutex
+	err error
+}
+
+func newRecorder(w io.Writer, format recordFormat) *recorder {
+	r := &recorder{format: format, w: bufio.NewWriter(w)}
+	if format == recordGob {
+		r.enc = gob.NewEncoder(r.w)
+	} else {
+		r.enc = json.NewEncoder(r.w)
+	}
+	return r
+}
+
+func (r *recorder) Tap(edge string, at time.Time, packet interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	p, err := encodePacket(r.format, packet)
+	if err == nil {
+		err = r.enc.Encode(record{edge, at, p})
+	}
+	if err != nil {
+		r.err = fmt.Errorf("cannot record packet on %s: %v", edge, err)
+	}
+}
+
+func (r *recorder) flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	return r.w.Flush()
+}
+
+func encodePacket(format recordFormat, packet interface{}) ([]byte, error) {
+	if format == recordJSON {
+		return json.Marshal(packet)
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(packet)
+	return buf.Bytes(), err
+}
+
+// `Record` writes every packet that passes one of the given edges to `w`,
+// until `stop` is called. `stop` returns the first error that occurred while
+// recording.
+func (n *network) Record(w io.Writer, format recordFormat, edges ...string) (stop func() error, err error) {
+	r := newRecorder(w, format)
+	var untaps []func() uint64
+	for _, e := range edges {
+		untap, err := n.Tap(e, r, tapOptions{Lossless: true})
+		if err != nil {
+			for _, u := range untaps {
+				u()
+			}
+			return nil, err
+		}
+		untaps = append(untaps, untap)
+	}
+	return func() error {
+		for _, u := range untaps {
+			u()
+		}
+		return r.flush()
+	}, nil
+}
+
+// A `recording` is a recording loaded into memory, ready for replay.
+type recording struct {
+	format  recordFormat
+	records []record
+}
+
+// `loadRecording` reads a recording in either format. Every edge has a tap
+// of its own, so the recording keeps the order of the packets on each edge,
+// but packets on different edges may be written out of order; loading sorts
+// them by time again.
+func loadRecording(r io.Reader) (*recording, error) {
+	br := bufio.NewReader(r)
+	rec := &recording{format: recordGob}
+	var dec interface{ Decode(interface{}) error }
+	if b, err := br.Peek(1); err == nil && b[0] == '{' {
+		rec.format = recordJSON
+		dec = json.NewDecoder(br)
+	} else {
+		dec = gob.NewDecoder(br)
+	}
+	for {
+		var p record
+		err := dec.Decode(&p)
+		if err == io.EOF {
+			sort.SliceStable(rec.records, func(i, j int) bool {
+				return rec.records[i].At.Before(rec.records[j].At)
+			})
+			return rec, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read recording: %v", err)
+		}
+		rec.records = append(rec.records, p)
+	}
+}
+
+// `Edges` returns the names of the recorded edges.
+func (rec *recording) Edges() []string {
+	var edges []string
+	seen := map[string]bool{}
+	for _, p := range rec.records {
+		if !seen[p.Edge] {
+			seen[p.Edge] = true
+			edges = append(edges, p.Edge)
+		}
+	}
+	return edges
+}
+
+// `replay` sends the packets that were recorded on `edge` to `out`, and
+// closes `out` at the end, just like the node at the other end of the edge
+// would do. To feed a subgraph, replay each of its input edges in a
+// goroutine of its own.
+//
+// If `c` is not nil, `replay` keeps the original time between the packets,
+// as measured by `c`; otherwise it sends them as fast as `out` accepts them.
+func replay[T any](rec *recording, edge string, out chan<- T, c clock) error {
+	defer close(out)
+	var last time.Time
+	for _, p := range rec.records {
+		if p.Edge != edge {
+			continue
+		}
+		var v T
+		var err error
+		if rec.format == recordJSON {
+			err = json.Unmarshal(p.Packet, &v)
+		} else {
+			err = gob.NewDecoder(bytes.NewReader(p.Packet)).Decode(&v)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot replay packet on %s: %v", edge, err)
+		}
+		if c != nil && !last.IsZero() {
+			<-c.After(p.At.Sub(last))
+		}
+		last = p.At
+		out <- v
+	}
+	return nil
+}
+
+// The fields of `count` are unexported, so it needs to encode itself for
+// recordings. Whole counts leave out the scale, as do recordings from before
+// counts had one.
+type countRecord struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+	Scale int    `json:"scale,omitempty"`
+}
+
+func (c *count) record() countRecord {
+	r := countRecord{Tag: c.tag, Count: c.count}
+	if c.scale > 1 {
+		r.Scale = c.scale
+	}
+	return r
+}
+
+func (c *count) set(r countRecord) {
+	c.tag, c.count, c.scale = r.Tag, r.Count, max(r.Scale, 1)
+}
+
+func (c *count) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.record())
+}
+
+func (c *count) UnmarshalJSON(b []byte) error {
+	var r countRecord
+	if err := json.Unmarshal(b, &r); err != nil {
+		return err
+	}
+	c.set(r)
+	return nil
+}
+
+func (c *count) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(c.record())
+	return buf.Bytes(), err
+}
+
+func (c *count) GobDecode(b []byte) error {
+	var r countRecord
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&r); err != nil {
+		return err
+	}
+	c.set(r)
+	return nil
+}
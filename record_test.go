@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// `pendingTimer` returns the deadline of the earliest timer that waits on
+// the clock.
+func pendingTimer(c *virtualClock) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.timers) == 0 {
+		return time.Time{}, false
+	}
+	return c.timers[0].at, true
+}
+
+func TestRecordReplay(t *testing.T) {
+	for _, format := range []recordFormat{recordJSON, recordGob} {
+		n, clock := virtualNetwork()
+		words := newEdge[string](n, "words", 10)
+		counts := newEdge[*count](n, "counts", 10)
+		var b bytes.Buffer
+		stop, err := n.Record(&b, format, "words", "counts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The edges take the timestamps when they accept a packet, so
+		// the clock must not move before they have.
+		send := func(f func(), sent func() uint64, d time.Duration) {
+			f()
+			waitFor(t, "the edge accepts the packet", func() bool { return sent() > 0 })
+			clock.Advance(d)
+		}
+		send(func() { words.In() <- "a" }, func() uint64 { return words.Stats().Sent }, 10*time.Millisecond)
+		send(func() { counts.In() <- &count{"Words", 1, 1} }, func() uint64 { return counts.Stats().Sent }, 20*time.Millisecond)
+		words.In() <- "b"
+		close(words.In())
+		close(counts.In())
+		for range words.Out() {
+		}
+		for range counts.Out() {
+		}
+		if err := stop(); err != nil {
+			t.Fatal(err)
+		}
+
+		rec, err := loadRecording(bytes.NewReader(b.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.format != format || !reflect.DeepEqual(rec.Edges(), []string{"words", "counts"}) {
+			t.Errorf("format %d: got format %d and edges %v", format, rec.format, rec.Edges())
+		}
+
+		// As fast as possible, in the original order.
+		out := make(chan string, 10)
+		if err := replay(rec, "words", out, nil); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for s := range out {
+			got = append(got, s)
+		}
+		if !reflect.DeepEqual(got, []string{"a", "b"}) {
+			t.Errorf("format %d: replayed %q, want a and b", format, got)
+		}
+		cs := make(chan *count, 10)
+		if err := replay(rec, "counts", cs, nil); err != nil {
+			t.Fatal(err)
+		}
+		if c := <-cs; c == nil || *c != (count{"Words", 1, 1}) {
+			t.Errorf("format %d: replayed count %+v", format, c)
+		}
+
+		// With the original timing: "b" was sent 30ms after "a".
+		rc := newVirtualClock(virtualEpoch)
+		timed := make(chan string)
+		result := make(chan error)
+		go func() {
+			result <- replay(rec, "words", timed, rc)
+		}()
+		if s := <-timed; s != "a" {
+			t.Errorf("format %d: got %q first", format, s)
+		}
+		var at time.Time
+		waitFor(t, "the replay waits for the next packet", func() bool {
+			var ok bool
+			at, ok = pendingTimer(rc)
+			return ok
+		})
+		if d := at.Sub(virtualEpoch); d != 30*time.Millisecond {
+			t.Errorf("format %d: the replay waits %v, want 30ms", format, d)
+		}
+		rc.Advance(30 * time.Millisecond)
+		if s := <-timed; s != "b" {
+			t.Errorf("format %d: got %q second", format, s)
+		}
+		if _, ok := <-timed; ok {
+			t.Errorf("format %d: the replay did not close its output", format)
+		}
+		if err := <-result; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	if _, err := loadRecording(strings.NewReader(`{"edge": "words"`)); err == nil || !strings.Contains(err.Error(), "cannot read recording") {
+		t.Errorf("got %v, want an error for a truncated recording", err)
+	}
+	rec, err := loadRecording(strings.NewReader(`{"edge":"words","at":"2024-05-01T12:00:00Z","packet":"a"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(chan int, 1)
+	if err := replay(rec, "words", out, nil); err == nil || !strings.Contains(err.Error(), "cannot replay packet on words") {
+		t.Errorf("got %v, want an error for the wrong packet type", err)
+	}
+	if _, ok := <-out; ok {
+		t.Error("the replay did not close its output after the error")
+	}
+}
+
+func TestCountRecord(t *testing.T) {
+	for _, c := range []count{{"Words", 8, 1}, {"Average word length", 450, 100}} {
+		b, err := c.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fromJSON count
+		if err := fromJSON.UnmarshalJSON(b); err != nil || fromJSON != c {
+			t.Errorf("JSON %s: got %+v, %v; want %+v", b, fromJSON, err, c)
+		}
+		b, err = c.GobEncode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fromGob count
+		if err := fromGob.GobDecode(b); err != nil || fromGob != c {
+			t.Errorf("gob: got %+v, %v; want %+v", fromGob, err, c)
+		}
+	}
+	// Recordings from before counts had a scale hold whole counts.
+	var c count
+	if err := c.UnmarshalJSON([]byte(`{"tag":"Words","count":8}`)); err != nil || c != (count{"Words", 8, 1}) {
+		t.Errorf("got %+v, %v", c, err)
+	}
+}
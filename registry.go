@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/appliedgo/flow2go/internal/graph"
+)
+
+// This file builds networks from graph definitions at run time, whereas
+// `fbpgen` turns them into code at build time. The components of a graph
+// are looked up by name in `registry`, and wired through reflection.
+
+// A `component` is a node type that graphs can use.
+type component struct {
+	Name string
+	Doc  string
+	// `New` returns a node with its configuration, but without channels.
+	New func() processor
+	// `Configure` applies the metadata of a process in the graph to a node
+	// from `New`. Components without `Configure` take no metadata. Neither
+	// sees the keys that only graph editors use, like x and y.
+	Configure func(node processor, metadata map[string]string) error
+}
+
+// `registry` lists the stock nodes by the name of their type. It is a
+// variable rather than an `init` function, so that it is complete before any
+// `init` function runs, like the one of the command line interface.
+var registry = stockComponents()
+
+func stockComponents() map[string]component {
+	registry := map[string]component{}
+	register := func(name, doc string, new func() processor) {
+		registry[name] = component{Name: name, Doc: doc, New: new}
+	}
+	configure := func(name string, f func(processor, map[string]string) error) {
+		c := registry[name]
+		c.Configure = f
+		registry[name] = c
+	}
+	register("splitter", "copies each sentence to Out1 and Out2", func() processor { return &splitter{} })
+	register("wordCounter", "counts the words of each sentence", func() processor { return &wordCounter{} })
+	register("letterCounter", "counts the letters of each sentence", func() processor { return &letterCounter{} })
+	register("printer", "prints the counts from Line1 and Line2", func() processor { return &printer{} })
+	register("router", "sends questions to Out[questions], or sentences matching the routes in metadata routes=file.json to their port; the rest to Default", func() processor {
+		return &router{routes: []route{{"questions", isQuestion}}}
+	})
+	configure("router", configureRouter)
+	register("segmenter", "splits blocks of text into sentences", func() processor { return &segmenter{} })
+	register("charCounter", "counts the characters of each sentence", func() processor { return &charCounter{} })
+	register("sentenceCounter", "counts the sentences in each string", func() processor { return &sentenceCounter{} })
+	register("syllableCounter", "estimates the syllables of each sentence", func() processor { return &syllableCounter{} })
+	register("punctuationCounter", "counts the punctuation of each sentence", func() processor { return &punctuationCounter{} })
+	register("vowelCounter", "counts the vowels of each sentence", func() processor { return &vowelCounter{} })
+	register("consonantCounter", "counts the consonants of each sentence", func() processor { return &consonantCounter{} })
+	register("wordLengthAverager", "sends the average word length of each sentence", func() processor { return &wordLengthAverager{} })
+	register("readabilityScorer", "sends the Flesch-Kincaid grade of each sentence", func() processor { return &readabilityScorer{} })
+	register("wordFrequency", "sends the 10 most frequent words, without stop words", func() processor {
+		return &wordFrequency{K: 10, FoldCase: true, StopWords: englishStopWords}
+	})
+	return registry
+}
+
+// `configureRouter` replaces the routes of a `router` with those in the
+// file that the metadata key "routes" names, in `routeConfig` format.
+// Relative paths are relative to the working directory.
+func configureRouter(node processor, metadata map[string]string) error {
+	r := node.(*router)
+	for k, v := range metadata {
+		if k != "routes" {
+			return fmt.Errorf("unknown metadata %s (want routes)", k)
+		}
+		f, err := os.Open(v)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r.routes = nil
+		if err := r.LoadRoutes(f); err != nil {
+			return fmt.Errorf("%s: %v", v, err)
+		}
+	}
+	return nil
+}
+
+// `components` returns the registry sorted by name.
+func components() []component {
+	var cs []component
+	for _, c := range registry {
+		cs = append(cs, c)
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Name < cs[j].Name })
+	return cs
+}
+
+// An `edgeMaker` creates and connects an edge for one packet type, and
+// returns its ends. (`edge[T]` can only be instantiated for types that are
+// known at compile time.)
+type edgeMaker func(n *network, name string, capacity int, from, to port) (in, out reflect.Value)
+
+func makeEdge[T any](n *network, name string, capacity int, from, to port) (in, out reflect.Value) {
+	e := newEdge[T](n, name, capacity).Connect(from.Node, from.Port, to.Node, to.Port)
+	return reflect.ValueOf(e.In()), reflect.ValueOf(e.Out())
+}
+
+// `edgeMakers` has an entry for every packet type of the stock nodes.
+var edgeMakers = map[reflect.Type]edgeMaker{
+	reflect.TypeOf(""):         makeEdge[string],
+	reflect.TypeOf(&count{}):   makeEdge[*count],
+	reflect.TypeOf(&ranking{}): makeEdge[*ranking],
+	reflect.TypeOf(struct{}{}): makeEdge[struct{}],
+}
+
+// A `wire` is a planned edge between two ports, or between a port and the
+// outside world, where the field is invalid.
+type wire struct {
+	name     string
+	elem     reflect.Type
+	capacity int
+	from, to graph.Endpoint
+	// The port fields to bind the ends of the edge to.
+	src, tgt reflect.Value
+}
+
+// A `graphPlan` is a graph with all ports resolved, ready to be built.
+type graphPlan struct {
+	nodes map[string]processor
+	order []string
+	wires []wire
+	// The names of the inports and outports, in the order of the graph.
+	inports, outports []string
+	// Ports that are not connected, by name and as fields. `build` closes
+	// unconnected input ports, and drains unconnected output ports.
+	Unconnected []string
+	unbound     []reflect.Value
+}
+
+// `planGraph` creates the nodes of `g`, without channels, and checks that all
+// connections are between existing ports of the same type. Connections
+// without a capacity in the graph get `capacity`. Edges cannot be
+// unbuffered, so capacities must be at least one. Planning has no side
+// effects, so it is all that `validate` needs.
+func planGraph(g *graph.Graph, capacity int) (*graphPlan, error) {
+	if capacity < 1 {
+		return nil, fmt.Errorf("capacity %d, but edges need a capacity of at least 1", capacity)
+	}
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	pl := &graphPlan{nodes: map[string]processor{}}
+	for _, p := range g.Processes {
+		c, ok := registry[p.Component]
+		if !ok {
+			return nil, fmt.Errorf("process %s: unknown component %s", p.Name, p.Component)
+		}
+		node := c.New()
+		cfg := p.Config()
+		switch {
+		case len(cfg) > 0 && c.Configure == nil:
+			return nil, fmt.Errorf("process %s: component %s takes no metadata", p.Name, p.Component)
+		case len(cfg) > 0:
+			if err := c.Configure(node, cfg); err != nil {
+				return nil, fmt.Errorf("process %s: %v", p.Name, err)
+			}
+		}
+		pl.nodes[p.Name] = node
+		pl.order = append(pl.order, p.Name)
+	}
+
+	bound := map[string]bool{}
+	resolve := func(e graph.Endpoint, output bool) (reflect.Value, reflect.Type, error) {
+		bound[e.Process+"."+e.Port] = true
+		return resolvePort(pl.nodes[e.Process], e, output)
+	}
+	add := func(w wire) error {
+		if _, ok := edgeMakers[w.elem]; !ok {
+			return fmt.Errorf("%s -> %s: no edges for packets of type %v", w.from, w.to, w.elem)
+		}
+		pl.wires = append(pl.wires, w)
+		return nil
+	}
+
+	for _, e := range g.Inports {
+		field, elem, err := resolve(e.Endpoint, false)
+		if err != nil {
+			return nil, fmt.Errorf("inport %s: %v", e.Name, err)
+		}
+		if err := add(wire{name: e.Name, elem: elem, capacity: capacity, from: graph.Endpoint{Port: e.Name}, to: e.Endpoint, tgt: field}); err != nil {
+			return nil, err
+		}
+		pl.inports = append(pl.inports, e.Name)
+	}
+	for _, c := range g.Connections {
+		src, srcElem, err := resolve(c.Src, true)
+		if err != nil {
+			return nil, err
+		}
+		tgt, tgtElem, err := resolve(c.Tgt, false)
+		if err != nil {
+			return nil, err
+		}
+		if srcElem != tgtElem {
+			return nil, fmt.Errorf("connection %s -> %s: %s sends %v, but %s receives %v", c.Src, c.Tgt, c.Src, srcElem, c.Tgt, tgtElem)
+		}
+		k := c.Capacity
+		if k < 0 {
+			return nil, fmt.Errorf("connection %s -> %s: capacity %d, but edges need a capacity of at least 1", c.Src, c.Tgt, k)
+		}
+		if k == 0 {
+			k = capacity
+		}
+		// Each output port has at most one connection, so it makes a
+		// unique edge name.
+		if err := add(wire{c.Src.String(), srcElem, k, c.Src, c.Tgt, src, tgt}); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range g.Outports {
+		field, elem, err := resolve(e.Endpoint, true)
+		if err != nil {
+			return nil, fmt.Errorf("outport %s: %v", e.Name, err)
+		}
+		if err := add(wire{name: e.Name, elem: elem, capacity: capacity, from: e.Endpoint, to: graph.Endpoint{Port: e.Name}, src: field}); err != nil {
+			return nil, err
+		}
+		pl.outports = append(pl.outports, e.Name)
+	}
+
+	for _, name := range pl.order {
+		v := reflect.ValueOf(pl.nodes[name]).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.IsExported() && f.Type.Kind() == reflect.Chan && !bound[name+"."+f.Name] {
+				pl.Unconnected = append(pl.Unconnected, name+"."+f.Name)
+				pl.unbound = append(pl.unbound, v.Field(i))
+			}
+		}
+	}
+	return pl, nil
+}
+
+// `resolvePort` looks up the channel field of an endpoint and checks its
+// direction. It returns the field, which is a map for ports like
+// `Out[questions]`, and the element type of the channel.
+func resolvePort(node processor, e graph.Endpoint, output bool) (reflect.Value, reflect.Type, error) {
+	v := reflect.ValueOf(node).Elem()
+	f, ok := v.Type().FieldByName(e.Port)
+	if !ok || !f.IsExported() {
+		return reflect.Value{}, nil, fmt.Errorf("%s: %s has no port %s", e, v.Type().Name(), e.Port)
+	}
+	typ := f.Type
+	isMap := typ.Kind() == reflect.Map && typ.Key().Kind() == reflect.String && typ.Elem().Kind() == reflect.Chan
+	if isMap {
+		typ = typ.Elem()
+	}
+	switch {
+	case typ.Kind() != reflect.Chan:
+		return reflect.Value{}, nil, fmt.Errorf("%s is not a port", e)
+	case output && typ.ChanDir() != reflect.SendDir:
+		return reflect.Value{}, nil, fmt.Errorf("%s is not an output port", e)
+	case !output && typ.ChanDir() != reflect.RecvDir:
+		return reflect.Value{}, nil, fmt.Errorf("%s is not an input port", e)
+	case isMap && e.Index == "":
+		return reflect.Value{}, nil, fmt.Errorf("%s needs a key, like %s[key]", e, e.Port)
+	case !isMap && e.Index != "":
+		return reflect.Value{}, nil, fmt.Errorf("%s: %s is not a map of channels", e, e.Port)
+	}
+	return v.FieldByIndex(f.Index), typ.Elem(), nil
+}
+
+// `bindPort` assigns one end of a channel to a port.
+func bindPort(field reflect.Value, e graph.Endpoint, ch reflect.Value) {
+	if field.Kind() == reflect.Map {
+		if field.IsNil() {
+			field.Set(reflect.MakeMap(field.Type()))
+		}
+		field.SetMapIndex(reflect.ValueOf(e.Index), ch.Convert(field.Type().Elem()))
+		return
+	}
+	field.Set(ch.Convert(field.Type()))
+}
+
+// `endpointPort` turns the endpoint "router.Out[questions]" into the port
+// {"router", "Out[questions]"}, and an outside endpoint into a port without
+// a node.
+func endpointPort(e graph.Endpoint) port {
+	if e.Process == "" {
+		return port{"", e.Port}
+	}
+	return port{e.Process, strings.TrimPrefix(e.String(), e.Process+".")}
+}
+
+// A `graphNet` is a network built from a graph definition.
+type graphNet struct {
+	*network
+	plan *graphPlan
+	// The network's inports and outports by name: the sending end of the
+	// edges into the network, and the receiving end of the edges out of it.
+	Inports  map[string]reflect.Value
+	Outports map[string]reflect.Value
+}
+
+// `build` creates the edges and binds them to the ports, but does not start
+// the nodes; see `start`. A plan can only be built once, as the nodes keep
+// their channels.
+func (pl *graphPlan) build() *graphNet {
+	gn := &graphNet{
+		network:  newNetwork(),
+		plan:     pl,
+		Inports:  map[string]reflect.Value{},
+		Outports: map[string]reflect.Value{},
+	}
+	for _, w := range pl.wires {
+		in, out := edgeMakers[w.elem](gn.network, w.name, w.capacity, endpointPort(w.from), endpointPort(w.to))
+		if w.src.IsValid() {
+			bindPort(w.src, w.from, in)
+		} else {
+			gn.Inports[w.name] = in
+		}
+		if w.tgt.IsValid() {
+			bindPort(w.tgt, w.to, out)
+		} else {
+			gn.Outports[w.name] = out
+		}
+	}
+	// Unconnected ports get a closed channel, or a channel that nobody but
+	// a drain reads, so that no node blocks on them.
+	for _, field := range pl.unbound {
+		ch := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, field.Type().Elem()), 0)
+		if field.Type().ChanDir() == reflect.RecvDir {
+			ch.Close()
+		} else {
+			go func() {
+				for {
+					if _, ok := ch.Recv(); !ok {
+						return
+					}
+				}
+			}()
+		}
+		field.Set(ch.Convert(field.Type()))
+	}
+	return gn
+}
+
+// `buildGraph` plans and builds a network from a graph definition.
+func buildGraph(g *graph.Graph, capacity int) (*graphNet, error) {
+	pl, err := planGraph(g, capacity)
+	if err != nil {
+		return nil, err
+	}
+	return pl.build(), nil
+}
+
+// `start` starts all nodes in the order of the graph.
+func (gn *graphNet) start() {
+	for _, name := range gn.plan.order {
+		gn.Start(name, gn.plan.nodes[name])
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/appliedgo/flow2go/internal/graph"
+)
+
+// The interactive mode of the command line interface:
+//
+//	./flow2go repl counternet.fbp
+//
+// starts the network, sends every line that is typed into it as a sentence,
+// and prints the results as they come out. Lines that start with ":" are
+// commands; see `replHelp`. With `-taps localhost:8080`, the packets that
+// `:tap` copies go to FBP protocol clients at ws://localhost:8080/taps.
+
+const replHelp = `Type a sentence to send it into the network. Commands:
+  :stats                 shows what went through the edges so far
+  :graph [dot|mermaid]   lists the edges, or draws the graph
+  :tap <edge> [regexp]   prints the packets that pass an edge, or only those that match
+  :untap <edge>          stops printing them
+  :help                  shows this text
+  :quit                  closes the input and waits for the network to shut down
+Start a sentence with "::" to send it with a single ":".
+`
+
+func (c *cli) repl(args []string) int {
+	fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+	capacity := fs.Int("capacity", 10, "capacity of the edges")
+	timeout := fs.Duration("timeout", time.Second, "how long to wait for the nodes to exit after :quit")
+	wsAddr := fs.String("taps", "", "send tapped packets to FBP protocol clients at ws://`address`/taps instead of printing them")
+	pos, code := c.parse(fs, args, 1)
+	if code >= 0 {
+		return code
+	}
+	g, pl, code := c.load(pos[0], *capacity)
+	if code >= 0 {
+		return code
+	}
+	// Results, taps, and the answers to commands all arrive concurrently.
+	w := &syncWriter{w: c.stdout}
+	gn, in, wait, err := launch(pl, runOptions{capacity: *capacity, w: w, format: "text", timeout: *timeout})
+	if err != nil {
+		return c.errorf(exitInvalid, "%s: %v", pos[0], err)
+	}
+	var sink tapSink = replSink{w}
+	if *wsAddr != "" {
+		ws, srv, err := ServeWebSocketTaps(gn.network, pos[0], *wsAddr)
+		if err != nil {
+			close(in)
+			wait()
+			return c.errorf(exitFailure, "%v", err)
+		}
+		defer srv.Close()
+		defer ws.Close()
+		sink = ws
+		fmt.Fprintf(c.stderr, "flow2go: taps go to ws://%s/taps\n", srv.Addr)
+	}
+	r := &replSession{g: g, gn: gn, w: w, sink: sink, taps: map[string]func() uint64{}}
+	fmt.Fprintln(c.stderr, "flow2go: type sentences, or :help for commands.")
+
+	stdin := c.stdin
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+	s := bufio.NewScanner(stdin)
+	s.Buffer(nil, maxLineLength)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "::"):
+			in <- line[1:]
+			continue
+		case !strings.HasPrefix(line, ":"):
+			in <- line
+			continue
+		}
+		if !r.command(strings.Fields(line[1:])) {
+			break
+		}
+	}
+	if err := s.Err(); err != nil {
+		fmt.Fprintf(c.stderr, "flow2go: %v\n", err)
+	}
+
+	// End of input and :quit both shut the network down. The taps stay
+	// until the network is done, so that they print everything that is
+	// still on its way.
+	close(in)
+	err = wait()
+	r.untapAll()
+	if err != nil {
+		return c.errorf(exitFailure, "%v", err)
+	}
+	return exitOK
+}
+
+// A `replSession` runs the commands of the interactive mode.
+type replSession struct {
+	g  *graph.Graph
+	gn *graphNet
+	w  io.Writer
+	// `sink` receives the tapped packets.
+	sink tapSink
+	// The `untap` functions of the active taps, by edge.
+	taps map[string]func() uint64
+}
+
+// `command` runs a command, without its leading ":". It returns false for
+// :quit.
+func (r *replSession) command(args []string) bool {
+	if len(args) == 0 {
+		fmt.Fprintln(r.w, "missing command; try :help")
+		return true
+	}
+	switch args[0] {
+	case "quit", "q":
+		return false
+	case "help", "h":
+		fmt.Fprint(r.w, replHelp)
+	case "stats":
+		printEdgeStats(r.w, r.gn.EdgeStats())
+	case "graph":
+		if len(args) > 1 {
+			if err := r.g.Render(r.w, args[1]); err != nil {
+				fmt.Fprintln(r.w, err)
+			}
+			return true
+		}
+		r.edges()
+	case "tap":
+		if len(args) < 2 || len(args) > 3 {
+			fmt.Fprintln(r.w, "usage: :tap <edge> [regexp]")
+			return true
+		}
+		r.tap(args[1], args[2:])
+	case "untap":
+		if len(args) != 2 {
+			fmt.Fprintln(r.w, "usage: :untap <edge>")
+			return true
+		}
+		r.untap(args[1])
+	default:
+		fmt.Fprintf(r.w, "unknown command :%s; try :help\n", args[0])
+	}
+	return true
+}
+
+// `edges` lists the edges that `tap` accepts.
+func (r *replSession) edges() {
+	outside := func(e graph.Endpoint) string {
+		if e.Process == "" {
+			return e.Port
+		}
+		return e.String()
+	}
+	tw := tabwriter.NewWriter(r.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "EDGE\tFROM\tTO\tCAPACITY")
+	for _, w := range r.gn.plan.wires {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", w.name, outside(w.from), outside(w.to), w.capacity)
+	}
+	tw.Flush()
+}
+
+func (r *replSession) tap(edge string, expr []string) {
+	if _, ok := r.taps[edge]; ok {
+		fmt.Fprintf(r.w, "%s is tapped already\n", edge)
+		return
+	}
+	var opts tapOptions
+	if len(expr) > 0 {
+		filter, err := matching(expr[0])
+		if err != nil {
+			fmt.Fprintln(r.w, err)
+			return
+		}
+		opts.Filter = filter
+	}
+	untap, err := r.gn.Tap(edge, r.sink, opts)
+	if err != nil {
+		fmt.Fprintln(r.w, err)
+		return
+	}
+	r.taps[edge] = untap
+}
+
+func (r *replSession) untap(edge string) {
+	untap, ok := r.taps[edge]
+	if !ok {
+		fmt.Fprintf(r.w, "%s is not tapped\n", edge)
+		return
+	}
+	delete(r.taps, edge)
+	if dropped := untap(); dropped > 0 {
+		fmt.Fprintf(r.w, "%s: %d packets were not printed\n", edge, dropped)
+	}
+}
+
+func (r *replSession) untapAll() {
+	var edges []string
+	for edge := range r.taps {
+		edges = append(edges, edge)
+	}
+	sort.Strings(edges)
+	for _, edge := range edges {
+		r.untap(edge)
+	}
+}
+
+// `replSink` prints tapped packets like the outports print them, rather than
+// as pointers.
+type replSink struct {
+	w io.Writer
+}
+
+func (s replSink) Tap(edge string, at time.Time, packet interface{}) {
+	if c, ok := packet.(*count); ok {
+		fmt.Fprintf(s.w, "[%s] %s: %s\n", edge, c.tag, c.value())
+		return
+	}
+	fmt.Fprintf(s.w, "[%s] %v\n", edge, packet)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// A `route` connects a predicate to a named output port of a `router`.
+type route struct {
+	port  string
+	match func(string) bool
+}
+
+// `router` sends each sentence to exactly one output port, depending on the
+// content of the sentence. Unlike `splitter`, which copies every sentence to
+// all of its outputs, `router` checks its routes in the order they were added
+// and picks the first one whose predicate matches.
+//
+// Sentences that match no route, or whose route points to a port that is not
+// connected, go to `Default`. If `Default` is nil, these sentences are dropped.
+type router struct {
+	In      <-chan string
+	Out     map[string]chan<- string
+	Default chan<- string
+	routes  []route
+}
+
+// `Route` appends a route that sends all sentences for which `match` returns
+// true to the output port `port`.
+func (r *router) Route(port string, match func(string) bool) {
+	r.routes = append(r.routes, route{port, match})
+}
+
+// `RouteRegexp` appends a route that sends all sentences matching the regular
+// expression `expr` to the output port `port`.
+func (r *router) RouteRegexp(port, expr string) error {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("route %q: %v", port, err)
+	}
+	r.Route(port, re.MatchString)
+	return nil
+}
+
+// `routeConfig` is the configuration format for regexp routes, a JSON list of
+// objects like `{"port": "questions", "match": "\\?$"}`. The order of the list
+// is the order in which the routes are checked.
+type routeConfig struct {
+	Port  string `json:"port"`
+	Match string `json:"match"`
+}
+
+// `LoadRoutes` reads a list of regexp routes in `routeConfig` format and
+// appends them to the router's routes.
+func (r *router) LoadRoutes(rd io.Reader) error {
+	var cfg []routeConfig
+	if err := json.NewDecoder(rd).Decode(&cfg); err != nil {
+		return fmt.Errorf("cannot read routes: %v", err)
+	}
+	for _, c := range cfg {
+		if err := r.RouteRegexp(c.Port, c.Match); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// `target` returns the output channel for a sentence, or nil if the sentence
+// shall be dropped.
+func (r *router) target(s string) chan<- string {
+	for _, rt := range r.routes {
+		if rt.match(s) {
+			if out, ok := r.Out[rt.port]; ok && out != nil {
+				return out
+			}
+			break
+		}
+	}
+	return r.Default
+}
+
+// `Process` reads the input channel and dispatches every sentence to its
+// target port. When the input channel is closed, `router` closes all of its
+// output channels, including `Default`.
+func (r *router) Process() {
+	fmt.Println("Router starts.")
+	go func() {
+		for {
+			s, ok := <-r.In
+			if !ok {
+				fmt.Println("Router has finished.")
+				// Ports that are not connected have nothing to close, and
+				// ports that share a channel close it only once.
+				closed := map[chan<- string]bool{nil: true}
+				for _, out := range r.Out {
+					if !closed[out] {
+						closed[out] = true
+						close(out)
+					}
+				}
+				if !closed[r.Default] {
+					close(r.Default)
+				}
+				return
+			}
+			if out := r.target(s); out != nil {
+				out <- s
+			}
+		}
+	}()
+}
+
+// Some ready-made predicates for `Route`.
+
+// `isQuestion` matches sentences that end with a question mark.
+func isQuestion(s string) bool {
+	return strings.HasSuffix(strings.TrimSpace(s), "?")
+}
+
+// `longerThan` returns a predicate that matches sentences with more than `n` words.
+func longerThan(n int) func(string) bool {
+	return func(s string) bool {
+		return len(strings.Fields(s)) > n
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/appliedgo/flow2go/internal/graph"
+)
+
+const testRoutes = `[
+  {"port": "questions", "match": "\\?$"},
+  {"port": "long", "match": "(\\w+\\W+){5}"}
+]`
+
+func TestRouterRoutes(t *testing.T) {
+	newRouter := func(setup func(r *router) error) *router {
+		r := &router{Out: map[string]chan<- string{"questions": nil, "long": nil}}
+		if err := setup(r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	in := ports{"In": {"Why?", "Because.", "This sentence has more than five words.", "Is this a question or a long sentence?"}}
+	want := ports{
+		"Out[questions]": {"Why?", "Is this a question or a long sentence?"},
+		"Out[long]":      {"This sentence has more than five words."},
+		"Default":        {"Because."},
+	}
+
+	t.Run("regexp", func(t *testing.T) {
+		expect(t, newRouter(func(r *router) error {
+			if err := r.RouteRegexp("questions", `\?$`); err != nil {
+				return err
+			}
+			return r.RouteRegexp("long", `(\w+\W+){5}`)
+		}), in, want)
+	})
+	t.Run("loaded", func(t *testing.T) {
+		expect(t, newRouter(func(r *router) error {
+			return r.LoadRoutes(strings.NewReader(testRoutes))
+		}), in, want)
+	})
+}
+
+func TestRouterErrors(t *testing.T) {
+	r := &router{}
+	if err := r.RouteRegexp("bad", "(unclosed"); err == nil || !strings.Contains(err.Error(), `route "bad"`) {
+		t.Errorf("got %v, want an error for route \"bad\"", err)
+	}
+	if err := r.LoadRoutes(strings.NewReader(`{"port": "questions"}`)); err == nil || !strings.Contains(err.Error(), "cannot read routes") {
+		t.Errorf("got %v, want an error for routes that are not a list", err)
+	}
+	if err := r.LoadRoutes(strings.NewReader(`[{"port": "x", "match": "["}]`)); err == nil || !strings.Contains(err.Error(), `route "x"`) {
+		t.Errorf("got %v, want an error for route \"x\"", err)
+	}
+	if len(r.routes) != 0 {
+		t.Errorf("got %d routes, want none", len(r.routes))
+	}
+}
+
+// A route to a port that is listed but not connected sends the sentence to
+// `Default`, and the router must not try to close the missing channel.
+func TestRouterUnconnectedPort(t *testing.T) {
+	in := make(chan string, 2)
+	in <- "Why?"
+	in <- "Because."
+	close(in)
+	def := make(chan string, 2)
+	r := &router{In: in, Out: map[string]chan<- string{"questions": nil}, Default: def, routes: []route{{"questions", isQuestion}}}
+	_, restore := captureStdout(t)
+	r.Process()
+	var got []string
+	for s := range def {
+		got = append(got, s)
+	}
+	restore()
+	if strings.Join(got, " ") != "Why? Because." {
+		t.Errorf("Default got %q, want both sentences", got)
+	}
+}
+
+// Ports may share a channel, which the router closes once.
+func TestRouterSharedChannel(t *testing.T) {
+	in := make(chan string, 1)
+	in <- "Why?"
+	close(in)
+	out := make(chan string, 1)
+	r := &router{In: in, Out: map[string]chan<- string{"questions": out, "long": out}, Default: out, routes: []route{{"questions", isQuestion}}}
+	_, restore := captureStdout(t)
+	defer restore()
+	r.Process()
+	var got []string
+	for s := range out {
+		got = append(got, s)
+	}
+	if strings.Join(got, " ") != "Why?" {
+		t.Errorf("got %q, want the question", got)
+	}
+}
+
+func TestConfigureRouter(t *testing.T) {
+	routes := writeFile(t, "routes.json", testRoutes)
+	plan := func(fbp string) (*graphPlan, error) {
+		g, err := graph.ParseFBP(strings.NewReader(fbp))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return planGraph(g, 1)
+	}
+
+	pl, err := plan("INPORT=r.In:In\nr(router:routes=" + routes + ") Out[long] -> Sentence wc(wordCounter)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := pl.nodes["r"].(*router)
+	if len(r.routes) != 2 || r.routes[0].port != "questions" || r.routes[1].port != "long" {
+		t.Errorf("got routes %+v, want questions and long", r.routes)
+	}
+	if pl, err := plan("r(router) Default -> Sentence wc(wordCounter)"); err != nil || len(pl.nodes["r"].(*router).routes) != 1 {
+		t.Errorf("without metadata, want the default route, got error %v", err)
+	}
+	// Graph editors store positions and labels in the metadata of every
+	// process.
+	if pl, err := plan("r(router:x=10,y=20,label=Router) Default -> Sentence wc(wordCounter:x=30,y=20)"); err != nil || len(pl.nodes["r"].(*router).routes) != 1 {
+		t.Errorf("with editor metadata, want the default route, got error %v", err)
+	}
+
+	for _, tt := range []struct{ fbp, err string }{
+		{"r(router:routes=missing.json) Default -> Sentence wc(wordCounter)", "process r: open missing.json"},
+		{"r(router:rules=x.json) Default -> Sentence wc(wordCounter)", "process r: unknown metadata rules"},
+		{"s(splitter:k=v) Out1 -> Sentence wc(wordCounter)", "process s: component splitter takes no metadata"},
+	} {
+		if _, err := plan(tt.fbp); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: got error %v, want %q", tt.fbp, err, tt.err)
+		}
+	}
+}
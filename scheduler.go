@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// The virtual clock of a deterministic network starts at the same time in
+// every run.
+var virtualEpoch = time.Date(2017, 3, 11, 0, 0, 0, 0, time.UTC)
+
+// `scheduler` runs a network in deterministic mode. Instead of letting the
+// edges move packets whenever the nodes are ready, the scheduler moves one
+// packet at a time, and only after every node has finished reacting to the
+// previous one. Whenever several edges could deliver a packet, a random
+// number generator with a fixed seed picks one. The same seed therefore
+// gives the same order of events in every run, and different seeds explore
+// different orders.
+//
+// Time comes from a `virtualClock`. When nothing can move, the scheduler
+// advances the clock to the next timer, so timeouts fire without any
+// waiting.
+type scheduler struct {
+	net   *network
+	rnd   *rand.Rand
+	clock *virtualClock
+}
+
+// `Deterministic` switches the network to deterministic mode. It must be
+// called before any edge is created. Start the nodes as usual, then call
+// `Run` on the returned scheduler.
+//
+// Nodes must be started through `Start`, as the scheduler finds out whether
+// a node is still busy by looking at the goroutines that `Start` has seen it
+// launch.
+func (n *network) Deterministic(seed int64) *scheduler {
+	s := &scheduler{
+		net:   n,
+		rnd:   rand.New(rand.NewSource(seed)),
+		clock: newVirtualClock(virtualEpoch),
+	}
+	n.mu.Lock()
+	n.sched = s
+	n.clock = s.clock
+	n.mu.Unlock()
+	return s
+}
+
+// `Run` moves packets until nothing can move anymore. It returns an error if
+// packets are left in the edges at that point, or edges have not been
+// closed, which means the network is deadlocked.
+//
+// The scheduler waits for the outside world at the network's input and
+// output edges. The outside world must therefore keep sending until it closes
+// the network's input edges, and keep receiving from the network's output
+// edges until they are closed.
+func (s *scheduler) Run() error {
+	for {
+		s.settle()
+		if s.step() {
+			continue
+		}
+		if s.clock.next() {
+			continue
+		}
+		return s.stuck()
+	}
+}
+
+// `step` moves a single packet. Taking packets from producers comes first,
+// so that the buffers fill up in a well-defined way; then a random edge
+// hands a packet to its consumer. The scheduler cannot tell whether the
+// outside world is busy, so it waits for it at the network's input and
+// output edges.
+func (s *scheduler) step() bool {
+	edges := s.net.links()
+	for _, e := range edges {
+		from, _ := e.Endpoints()
+		if e.collect(from.Node == "") {
+			return true
+		}
+	}
+	for _, i := range s.rnd.Perm(len(edges)) {
+		_, to := edges[i].Endpoints()
+		if edges[i].deliver(to.Node == "") {
+			return true
+		}
+	}
+	return false
+}
+
+// `settle` waits until every goroutine of the network's nodes waits for
+// another goroutine.
+func (s *scheduler) settle() {
+	for {
+		busy := false
+		for _, g := range s.net.nodeGoroutines() {
+			if !g.waiting() {
+				busy = true
+				break
+			}
+		}
+		if !busy {
+			return
+		}
+		runtime.Gosched()
+	}
+}
+
+func (s *scheduler) stuck() error {
+	var stuck []string
+	for _, e := range s.net.EdgeStats() {
+		if e.Len > 0 {
+			stuck = append(stuck, fmt.Sprintf("%s holds %d packets", e.Name, e.Len))
+		} else if l := s.net.edge(e.Name); !l.closed() {
+			stuck = append(stuck, e.Name+" is still open")
+		}
+	}
+	if len(stuck) == 0 {
+		return nil
+	}
+	return fmt.Errorf("network is deadlocked: %s", strings.Join(stuck, ", "))
+}
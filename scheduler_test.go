@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// `runDeterministic` runs the counter network with the given seed and
+// returns everything it printed.
+func runDeterministic(t *testing.T, seed int64, input []string) []interface{} {
+	t.Helper()
+	stdout, restore := captureStdout(t)
+	defer restore()
+	n := newNetwork()
+	s := n.Deterministic(seed)
+	in, done := buildCounterNet(n, 2)
+	go func() {
+		for _, sentence := range input {
+			in <- sentence
+		}
+		close(in)
+	}()
+	if err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	restore()
+	return <-stdout
+}
+
+func TestDeterministicOrder(t *testing.T) {
+	input := []string{
+		"I never put off till tomorrow what I can do the day after.",
+		"Fashion is a form of ugliness so intolerable that we have to alter it every six months.",
+		"Life is too important to be taken seriously.",
+	}
+	orders := map[string]bool{}
+	for seed := int64(0); seed < 10; seed++ {
+		first := runDeterministic(t, seed, input)
+		if again := runDeterministic(t, seed, input); !reflect.DeepEqual(first, again) {
+			t.Fatalf("seed %d printed\n%v\nand then\n%v", seed, first, again)
+		}
+		orders[fmt.Sprint(first)] = true
+	}
+	if len(orders) < 2 {
+		t.Errorf("10 seeds gave only %d order of events", len(orders))
+	}
+}
+
+// `delay` is a time-based node for testing the virtual clock. It forwards
+// every packet after waiting for `D`.
+type delay struct {
+	In    <-chan string
+	Out   chan<- string
+	D     time.Duration
+	Clock clock
+}
+
+func (d *delay) Process() {
+	go func() {
+		for s := range d.In {
+			<-d.Clock.After(d.D)
+			d.Out <- s
+		}
+		close(d.Out)
+	}()
+}
+
+// `clockReader` notes the time of the network clock when each packet
+// arrives. It runs inside the network, so the scheduler cannot advance the
+// clock while a packet is on its way to it.
+type clockReader struct {
+	In    <-chan string
+	Clock clock
+	Got   []time.Duration
+	Done  chan struct{}
+}
+
+func (r *clockReader) Process() {
+	go func() {
+		for range r.In {
+			r.Got = append(r.Got, r.Clock.Now().Sub(virtualEpoch))
+		}
+		close(r.Done)
+	}()
+}
+
+func TestDeterministicClock(t *testing.T) {
+	n := newNetwork()
+	s := n.Deterministic(1)
+	in := newEdge[string](n, "in", 1).Connect("", "In", "delay", "In")
+	out := newEdge[string](n, "out", 1).Connect("delay", "Out", "reader", "In")
+	n.Start("delay", &delay{In: in.Out(), Out: out.In(), D: time.Hour, Clock: n.Clock()})
+	r := &clockReader{In: out.Out(), Clock: n.Clock(), Done: make(chan struct{})}
+	n.Start("reader", r)
+
+	go func() {
+		in.In() <- "a"
+		in.In() <- "b"
+		close(in.In())
+	}()
+	if err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+	<-r.Done
+	if want := []time.Duration{time.Hour, 2 * time.Hour}; !reflect.DeepEqual(r.Got, want) {
+		t.Errorf("packets arrived after %v, want %v", r.Got, want)
+	}
+}
+
+// `stuck` never reads its input.
+type stuck struct {
+	In <-chan string
+}
+
+func (s *stuck) Process() {
+	go func() {
+		select {}
+	}()
+}
+
+func TestDeterministicDeadlock(t *testing.T) {
+	n := newNetwork()
+	s := n.Deterministic(1)
+	in := newEdge[string](n, "in", 1).Connect("", "In", "stuck", "In")
+	n.Start("stuck", &stuck{In: in.Out()})
+	go func() {
+		in.In() <- "a"
+		in.In() <- "b"
+		close(in.In())
+	}()
+	if err := s.Run(); err == nil {
+		t.Error("Run did not report a deadlock")
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// `segmenter` turns raw text into sentences, so that the counters can work
+// on whole documents. It reads blocks of text from `In`, for example the
+// lines or paragraphs of a file, and sends each sentence to `Out`, with all
+// whitespace, including line breaks, collapsed into single spaces.
+//
+// A sentence may continue in the next block; `segmenter` joins consecutive
+// blocks with a line break, so a block should not end in the middle of a
+// word. A blank line, or a block that is empty or only contains whitespace,
+// ends a paragraph and hence the sentence, with or without punctuation.
+//
+// Within a paragraph, a sentence ends with ".", "!", "?", or an ellipsis,
+// followed by any closing quotes or brackets and then a space, unless
+//
+//   - the next word starts with a lower-case letter, as in "Wait... what?",
+//   - the sentence ends with "." after an abbreviation like "Dr." or "e.g.",
+//     or after an initial, as in "J. R. R. Tolkien".
+type segmenter struct {
+	In  <-chan string
+	Out chan<- string
+	// `Abbreviations` are words that end with a dot but do not end a
+	// sentence, in lower case and without the final dot. Defaults to
+	// `englishAbbreviations`.
+	Abbreviations map[string]bool
+}
+
+// `englishAbbreviations` are common English abbreviations. "etc." is not
+// among them, as it often ends a sentence.
+var englishAbbreviations = stopWords(
+	"a.m", "al", "approx", "cf", "co", "dr", "e.g", "fig", "i.e", "inc", "jr",
+	"ltd", "mr", "mrs", "ms", "mt", "no", "p.m", "prof", "sr", "st", "vs",
+)
+
+func (sg *segmenter) Process() {
+	fmt.Println("Segmenter starts.")
+	go func() {
+		abbr := sg.Abbreviations
+		if abbr == nil {
+			abbr = englishAbbreviations
+		}
+		// The pending text has been scanned up to `scanned` already, and
+		// blocks are appended to it without copying it, so that a long
+		// sentence across many blocks costs no more than a short one.
+		var pending strings.Builder
+		scanned := 0
+		for block := range sg.In {
+			if strings.TrimSpace(block) == "" {
+				sentences, _, _ := segment(pending.String(), scanned, abbr, true)
+				sg.send(sentences)
+				pending.Reset()
+				scanned = 0
+				continue
+			}
+			if pending.Len() > 0 {
+				pending.WriteByte('\n')
+			}
+			pending.WriteString(block)
+			text := pending.String()
+			sentences, rest, resume := segment(text, scanned, abbr, false)
+			if len(rest) < len(text) {
+				pending.Reset()
+				pending.WriteString(rest)
+			}
+			scanned = resume
+			sg.send(sentences)
+		}
+		sentences, _, _ := segment(pending.String(), scanned, abbr, true)
+		sg.send(sentences)
+		fmt.Println("Segmenter has finished.")
+		close(sg.Out)
+	}()
+}
+
+func (sg *segmenter) send(sentences []string) {
+	for _, s := range sentences {
+		sg.Out <- s
+	}
+}
+
+// `segment` splits `text` into sentences. Unless `final` is true, the text
+// may continue, so `segment` returns the last sentence as `rest` if it
+// cannot tell yet whether it is complete. The text before `from` contains no
+// sentence end; `segment` starts scanning there. It returns where to resume
+// in `rest` once more text has been appended: at the terminal punctuation
+// whose next word is missing, or else at the trailing whitespace, which may
+// turn out to be a paragraph break.
+func segment(text string, from int, abbr map[string]bool, final bool) (sentences []string, rest string, resume int) {
+	start := 0
+	stop := len(strings.TrimRightFunc(text, unicode.IsSpace))
+	emit := func(end int) {
+		if s := strings.Join(strings.Fields(text[start:end]), " "); s != "" {
+			sentences = append(sentences, s)
+		}
+	}
+	for i := from; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r == '\n' {
+			if end := paragraphEnd(text, i); end > 0 {
+				emit(i)
+				start, i = end, end
+				continue
+			}
+		}
+		if !isTerminal(r) {
+			i += size
+			continue
+		}
+		j := i
+		for j < len(text) {
+			r, size := utf8.DecodeRuneInString(text[j:])
+			if !isTerminal(r) && !strings.ContainsRune(`"')]”’»`, r) {
+				break
+			}
+			j += size
+		}
+		run := strings.TrimRight(text[i:j], `"')]”’»`)
+		if j < len(text) {
+			if r, _ := utf8.DecodeRuneInString(text[j:]); !unicode.IsSpace(r) {
+				// "3.14" or "example.com"
+				i = j
+				continue
+			}
+		}
+		k := j
+		for k < len(text) {
+			r, size := utf8.DecodeRuneInString(text[k:])
+			if !unicode.IsSpace(r) {
+				break
+			}
+			k += size
+		}
+		if k == len(text) {
+			// The next word is not there yet.
+			stop = i
+			break
+		}
+		next, _ := utf8.DecodeRuneInString(text[k:])
+		if endsSentence(text[start:i], run, next, abbr) {
+			emit(j)
+			start = j
+		}
+		i = j
+	}
+	if final {
+		emit(len(text))
+		return sentences, "", 0
+	}
+	return sentences, text[start:], max(stop-start, 0)
+}
+
+// `paragraphEnd` returns the end of the blank line that starts with the line
+// break at `i`, or 0 if the next line is not blank.
+func paragraphEnd(text string, i int) int {
+	for j := i + 1; j < len(text); j++ {
+		switch text[j] {
+		case '\n':
+			return j + 1
+		case ' ', '\t', '\r':
+		default:
+			return 0
+		}
+	}
+	return 0
+}
+
+// `endsSentence` decides whether the terminal punctuation `run` after the
+// text `before` ends the sentence, given the first rune of the next word.
+func endsSentence(before, run string, next rune, abbr map[string]bool) bool {
+	if unicode.IsLower(next) {
+		return false
+	}
+	if run != "." {
+		return true
+	}
+	word := before
+	if i := strings.LastIndexFunc(before, unicode.IsSpace); i >= 0 {
+		word = before[i+1:]
+	}
+	word = strings.TrimLeft(word, `"'([“‘«`)
+	if abbr[strings.ToLower(word)] {
+		return false
+	}
+	first, size := utf8.DecodeRuneInString(word)
+	return !(size == len(word) && unicode.IsUpper(first))
+}
@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+func TestSegmenter(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []interface{}
+		want []interface{}
+	}{
+		{"sentences",
+			[]interface{}{"I never put off till tomorrow. Life is too important! Is it?"},
+			[]interface{}{"I never put off till tomorrow.", "Life is too important!", "Is it?"}},
+		{"abbreviations and initials",
+			[]interface{}{"Dr. Watson met J. R. R. Tolkien, e.g. at 3 p.m. today. He left."},
+			[]interface{}{"Dr. Watson met J. R. R. Tolkien, e.g. at 3 p.m. today.", "He left."}},
+		{"numbers",
+			[]interface{}{"Pi is 3.14. It never ends."},
+			[]interface{}{"Pi is 3.14.", "It never ends."}},
+		{"quotes",
+			[]interface{}{`He said, "Stop." Then he left. "Why?" she asked.`},
+			[]interface{}{`He said, "Stop."`, "Then he left.", `"Why?" she asked.`}},
+		{"ellipses",
+			[]interface{}{"Wait... what? I see… Fine."},
+			[]interface{}{"Wait... what?", "I see…", "Fine."}},
+		{"line breaks",
+			[]interface{}{"Fashion is a form of ugliness\nso intolerable that we", "have to alter it every six months. Life is", "too important."},
+			[]interface{}{"Fashion is a form of ugliness so intolerable that we have to alter it every six months.", "Life is too important."}},
+		{"paragraphs",
+			[]interface{}{"A heading\n\nThe text.", "", "Another heading", "  ", "More text"},
+			[]interface{}{"A heading", "The text.", "Another heading", "More text"}},
+		{"sentence at the end of a block",
+			[]interface{}{"It ends here.", "Or does it."},
+			[]interface{}{"It ends here.", "Or does it."}},
+		{"abbreviation at the end of a block",
+			[]interface{}{"Ask Dr.", "Watson."},
+			[]interface{}{"Ask Dr. Watson."}},
+		{"sentence across many blocks",
+			[]interface{}{"I never put", "off till", "tomorrow what I can do", "the day after. Life", "is too important."},
+			[]interface{}{"I never put off till tomorrow what I can do the day after.", "Life is too important."}},
+		{"paragraph break across blocks",
+			[]interface{}{"A heading\n", "The text."},
+			[]interface{}{"A heading", "The text."}},
+		{"no input", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expect(t, &segmenter{}, ports{"In": tt.in}, ports{"Out": tt.want})
+		})
+	}
+}
+
+func TestSegmentResume(t *testing.T) {
+	tests := []struct {
+		text, rest string
+		resume     int
+	}{
+		{"Life is too", "Life is too", 11},
+		{"Life is too  ", "Life is too  ", 11},
+		{"It ends. Or does it.  ", " Or does it.  ", 11},
+		{"Ask Dr.", "Ask Dr.", 6},
+	}
+	for _, tt := range tests {
+		_, rest, resume := segment(tt.text, 0, englishAbbreviations, false)
+		if rest != tt.rest || resume != tt.resume {
+			t.Errorf("segment(%q) left %q to resume at %d, want %q at %d", tt.text, rest, resume, tt.rest, tt.resume)
+		}
+	}
+}
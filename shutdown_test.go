@@ -0,0 +1,193 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// These tests check the shutdown semantics of the stock nodes: closing the
+// network's input must close every edge and eventually `Done`, no matter how
+// the nodes are wired, how much input arrives, or when the input is closed.
+// A node that sends on a closed channel, or closes a channel twice, panics
+// and crashes the test binary, which the fuzzer reports with the input that
+// caused it.
+
+// How long a random network may take to shut down, and how long its
+// goroutines may take to exit after that.
+const shutdownTimeout = 2 * time.Second
+
+// The maximum depth of a random network, counted in nodes between the
+// input and a counter.
+const maxRandomDepth = 3
+
+// `randomNet` builds a network from the stock nodes, driven by a byte
+// string: each byte picks the next node or wiring option. When the bytes run
+// out, all remaining branches end in a counter.
+type randomNet struct {
+	choices  []byte
+	capacity int
+	nodes    []processor
+	counts   []<-chan *count
+	dones    []<-chan struct{}
+}
+
+func (g *randomNet) choose(n int) int {
+	if len(g.choices) == 0 {
+		return 0
+	}
+	c := int(g.choices[0]) % n
+	g.choices = g.choices[1:]
+	return c
+}
+
+// `sentences` adds the nodes that process the sentences from `in`.
+func (g *randomNet) sentences(in <-chan string, depth int) {
+	kind := 0
+	if depth < maxRandomDepth {
+		kind = g.choose(3)
+	}
+	switch kind {
+	case 0:
+		out := make(chan *count, g.capacity)
+		if g.choose(2) == 0 {
+			g.nodes = append(g.nodes, &wordCounter{Sentence: in, Count: out})
+		} else {
+			g.nodes = append(g.nodes, &letterCounter{Sentence: in, Count: out})
+		}
+		g.counts = append(g.counts, out)
+	case 1:
+		out1 := make(chan string, g.capacity)
+		out2 := make(chan string, g.capacity)
+		g.nodes = append(g.nodes, &splitter{In: in, Out1: out1, Out2: out2})
+		g.sentences(out1, depth+1)
+		g.sentences(out2, depth+1)
+	case 2:
+		// Each port of the router is either connected, listed but not
+		// connected, or missing. At least one output is connected, so that
+		// the test can tell when the router has finished.
+		r := &router{In: in, Out: map[string]chan<- string{}}
+		r.Route("questions", isQuestion)
+		r.Route("long", longerThan(5))
+		for _, p := range []string{"questions", "long"} {
+			switch g.choose(3) {
+			case 0:
+				out := make(chan string, g.capacity)
+				r.Out[p] = out
+				g.sentences(out, depth+1)
+			case 1:
+				r.Out[p] = nil
+			}
+		}
+		if r.Out["questions"] == nil && r.Out["long"] == nil || g.choose(2) == 0 {
+			out := make(chan string, g.capacity)
+			r.Default = out
+			g.sentences(out, depth+1)
+		}
+		g.nodes = append(g.nodes, r)
+	}
+}
+
+// `printers` connects the counters to printers, two at a time. If a counter
+// is left over, its printer gets a closed channel as its second line.
+func (g *randomNet) printers() {
+	for i := 0; i < len(g.counts); i += 2 {
+		p := &printer{Line1: g.counts[i]}
+		if i+1 < len(g.counts) {
+			p.Line2 = g.counts[i+1]
+		} else {
+			closed := make(chan *count)
+			close(closed)
+			p.Line2 = closed
+		}
+		done := make(chan struct{})
+		p.Done = done
+		g.nodes = append(g.nodes, p)
+		g.dones = append(g.dones, done)
+	}
+}
+
+// `stockGoroutines` counts the goroutines started by the stock nodes.
+func stockGoroutines() int {
+	n := 0
+	for _, g := range goroutines() {
+		switch typ, _ := g.NodeType(); typ {
+		case "splitter", "wordCounter", "letterCounter", "printer", "router":
+			n++
+		}
+	}
+	return n
+}
+
+// `checkShutdown` builds a random network, sends it the first `closeAfter`
+// sentences of `input`, closes the input, and checks that the network shuts
+// down and leaves no goroutines behind.
+func checkShutdown(t *testing.T, choices []byte, input []string, closeAfter, capacity int) bool {
+	t.Helper()
+	before := stockGoroutines()
+	_, restore := captureStdout(t)
+	defer restore()
+
+	in := make(chan string, capacity)
+	g := &randomNet{choices: choices, capacity: capacity}
+	g.sentences(in, 0)
+	g.printers()
+	for _, n := range g.nodes {
+		n.Process()
+	}
+
+	if closeAfter < len(input) {
+		input = input[:closeAfter]
+	}
+	timeout := time.After(shutdownTimeout)
+	for _, s := range input {
+		select {
+		case in <- s:
+		case <-timeout:
+			restore()
+			t.Errorf("network with %d nodes did not accept input", len(g.nodes))
+			return false
+		}
+	}
+	close(in)
+	for _, done := range g.dones {
+		select {
+		case <-done:
+		case <-timeout:
+			restore()
+			t.Errorf("network with %d nodes did not shut down within %v", len(g.nodes), shutdownTimeout)
+			return false
+		}
+	}
+
+	// The nodes' goroutines exit right after closing their outputs.
+	for deadline := time.Now().Add(shutdownTimeout); stockGoroutines() > before; {
+		if time.Now().After(deadline) {
+			restore()
+			t.Errorf("%d goroutines of a network with %d nodes are still running after shutdown", stockGoroutines()-before, len(g.nodes))
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
+
+func TestShutdown(t *testing.T) {
+	check := func(choices []byte, input []string, closeAfter, capacity uint8) bool {
+		return checkShutdown(t, choices, input, int(closeAfter), int(capacity%4))
+	}
+	if err := quick.Check(check, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func FuzzShutdown(f *testing.F) {
+	f.Add([]byte{}, "Why?\nBecause.", uint8(2), uint8(0))
+	f.Add([]byte{1, 2, 0, 1, 1, 0}, "Life is too important to be taken seriously.", uint8(1), uint8(1))
+	f.Add([]byte{2, 1, 1, 0, 2, 2, 1}, "Is it?\nIt is what it is, and always will be.\n\n", uint8(255), uint8(3))
+	f.Add([]byte{1, 1, 1, 1, 1, 1, 1}, "a\nb\nc", uint8(0), uint8(2))
+	f.Fuzz(func(t *testing.T, choices []byte, text string, closeAfter, capacity uint8) {
+		checkShutdown(t, choices, strings.Split(text, "\n"), int(closeAfter), int(capacity%4))
+	})
+}
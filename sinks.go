@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+// The formats that `countWriter` can write.
+type sinkFormat int
+
+const (
+	// One JSON object per line, like {"tag":"Words","count":8}.
+	sinkJSONLines sinkFormat = iota
+	// CSV with a "tag,count" header.
+	sinkCSV
+	// A text table with aligned columns. As the column widths depend on all
+	// rows, the table appears only at the end.
+	sinkTable
+)
+
+// `parseSinkFormat` accepts "jsonl", "csv", and "table".
+func parseSinkFormat(s string) (sinkFormat, error) {
+	switch s {
+	case "jsonl":
+		return sinkJSONLines, nil
+	case "csv":
+		return sinkCSV, nil
+	case "table":
+		return sinkTable, nil
+	}
+	return 0, fmt.Errorf("unknown output format %q (want jsonl, csv, or table)", s)
+}
+
+// `countWriter` is a sink like `printer`, but writes the counts in a
+// structured format to `W`, or to the file at `Path` if `W` is nil. Output is
+// buffered; `countWriter` flushes it, and closes the file, before it closes
+// `Done`, so everything is written once `Done` is closed.
+type countWriter struct {
+	Line1  <-chan *count
+	Line2  <-chan *count
+	Done   chan<- struct{}
+	W      io.Writer
+	Path   string
+	Format sinkFormat
+	// `OnError` receives write errors. After an error, `countWriter` drops
+	// all counts until its inputs are closed. Defaults to printing the error
+	// to stderr.
+	OnError func(error)
+}
+
+// A `rowWriter` writes one row per count, and everything that is still
+// buffered on `flush`.
+type rowWriter interface {
+	write(c *count) error
+	flush() error
+}
+
+func (cw *countWriter) Process() {
+	fmt.Println("CountWriter starts.")
+	in := (&printer{Line1: cw.Line1, Line2: cw.Line2}).merge()
+	go func() {
+		onError := cw.OnError
+		if onError == nil {
+			onError = func(err error) {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+		rw, closeFile, err := cw.open()
+		for c := range in {
+			if err == nil {
+				err = rw.write(c)
+			}
+		}
+		if rw != nil {
+			if ferr := rw.flush(); err == nil {
+				err = ferr
+			}
+		}
+		if cerr := closeFile(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			onError(fmt.Errorf("countWriter: %v", err))
+		}
+		fmt.Println("CountWriter has finished.")
+		close(cw.Done)
+	}()
+}
+
+func (cw *countWriter) open() (rw rowWriter, closeFile func() error, err error) {
+	closeFile = func() error { return nil }
+	w := cw.W
+	if w == nil {
+		f, err := os.Create(cw.Path)
+		if err != nil {
+			return nil, closeFile, err
+		}
+		w, closeFile = f, f.Close
+	}
+	switch cw.Format {
+	case sinkCSV:
+		rw = newCSVRows(w)
+	case sinkTable:
+		rw = newTableRows(w)
+	default:
+		rw = newJSONRows(w)
+	}
+	return rw, closeFile, nil
+}
+
+type jsonRows struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func newJSONRows(w io.Writer) *jsonRows {
+	bw := bufio.NewWriter(w)
+	return &jsonRows{bw, json.NewEncoder(bw)}
+}
+
+// `jsonRow` is a count as the JSON sink writes it, with the count divided
+// by its scale, unlike the recordings in record.go.
+type jsonRow struct {
+	Tag   string      `json:"tag"`
+	Count json.Number `json:"count"`
+}
+
+func (r *jsonRows) write(c *count) error { return r.enc.Encode(jsonRow{c.tag, json.Number(c.value())}) }
+func (r *jsonRows) flush() error         { return r.w.Flush() }
+
+type csvRows struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVRows(w io.Writer) *csvRows {
+	return &csvRows{w: csv.NewWriter(w)}
+}
+
+func (r *csvRows) writeHeader() error {
+	if r.header {
+		return nil
+	}
+	r.header = true
+	return r.w.Write([]string{"tag", "count"})
+}
+
+func (r *csvRows) write(c *count) error {
+	if err := r.writeHeader(); err != nil {
+		return err
+	}
+	return r.w.Write([]string{c.tag, c.value()})
+}
+
+func (r *csvRows) flush() error {
+	// Write the header even if there were no counts.
+	if err := r.writeHeader(); err != nil {
+		return err
+	}
+	r.w.Flush()
+	return r.w.Error()
+}
+
+type tableRows struct {
+	w *tabwriter.Writer
+}
+
+func newTableRows(w io.Writer) *tableRows {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TAG\tCOUNT")
+	return &tableRows{tw}
+}
+
+func (r *tableRows) write(c *count) error {
+	_, err := fmt.Fprintf(r.w, "%s\t%s\n", c.tag, c.value())
+	return err
+}
+
+func (r *tableRows) flush() error { return r.w.Flush() }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCountWriter(t *testing.T) {
+	counts := []interface{}{&count{"Words", 8, 1}, &count{"Letters", 36, 1}, &count{"Average word length", 450, 100}}
+	tests := []struct {
+		name   string
+		format sinkFormat
+		in     []interface{}
+		want   string
+	}{
+		{"jsonl", sinkJSONLines, counts,
+			`{"tag":"Words","count":8}` + "\n" + `{"tag":"Letters","count":36}` + "\n" + `{"tag":"Average word length","count":4.50}` + "\n"},
+		{"csv", sinkCSV, counts,
+			"tag,count\nWords,8\nLetters,36\nAverage word length,4.50\n"},
+		{"csv without counts", sinkCSV, nil,
+			"tag,count\n"},
+		{"table", sinkTable, counts,
+			"TAG                  COUNT\nWords                8\nLetters              36\nAverage word length  4.50\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			cw := &countWriter{W: &buf, Format: tt.format, OnError: func(err error) { t.Error(err) }}
+			// `expect` returns after `Done` is closed, so everything must
+			// have been flushed by then.
+			expect(t, cw, ports{"Line1": tt.in, "Line2": nil}, ports{})
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountWriterFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counts.csv")
+	cw := &countWriter{Path: path, Format: sinkCSV, OnError: func(err error) { t.Error(err) }}
+	expect(t, cw, ports{"Line1": {&count{"Words", 8, 1}}, "Line2": {&count{"Words", 2, 1}}}, ports{})
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 3 || lines[0] != "tag,count" {
+		t.Errorf("got %q, want a header and 2 rows", lines)
+	}
+
+	var errs []error
+	cw = &countWriter{Path: filepath.Join(t.TempDir(), "missing", "counts.csv"), OnError: func(err error) { errs = append(errs, err) }}
+	expect(t, cw, ports{"Line1": {&count{"Words", 8, 1}}, "Line2": nil}, ports{})
+	if len(errs) != 1 {
+		t.Errorf("got errors %v, want one", errs)
+	}
+}
+
+func TestParseSinkFormat(t *testing.T) {
+	for s, want := range map[string]sinkFormat{"jsonl": sinkJSONLines, "csv": sinkCSV, "table": sinkTable} {
+		if got, err := parseSinkFormat(s); err != nil || got != want {
+			t.Errorf("parseSinkFormat(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	if _, err := parseSinkFormat("xml"); err == nil {
+		t.Error("parseSinkFormat accepted xml")
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// `fileSource` reads text from files and sends it to `Out`, line by line or
+// as whole documents, and closes `Out` after the last file. Put a
+// `segmenter` behind it to get sentences for the counters.
+//
+// Each entry of `Paths` can be
+//
+//   - a file name,
+//   - a glob pattern like "texts/*.txt",
+//   - a directory, which is read recursively, in lexical order, or
+//   - "-" for stdin.
+//
+// Files ending in ".gz" are decompressed on the fly.
+type fileSource struct {
+	Out   chan<- string
+	Paths []string
+	// `Documents` sends the contents of each file as a single packet,
+	// rather than each line.
+	Documents bool
+	// `Stdin` is what "-" reads from. Defaults to `os.Stdin`.
+	Stdin io.Reader
+	// `OnError` receives errors like missing or unreadable files;
+	// `fileSource` then continues with the next file. Defaults to printing
+	// the error to stderr.
+	OnError func(error)
+}
+
+// Lines longer than this are an error.
+const maxLineLength = 1 << 20
+
+func (src *fileSource) Process() {
+	fmt.Println("FileSource starts.")
+	go func() {
+		onError := src.OnError
+		if onError == nil {
+			onError = func(err error) {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+		for _, p := range src.Paths {
+			files, err := expandPath(p)
+			if err != nil {
+				onError(err)
+			}
+			for _, f := range files {
+				if err := src.read(f); err != nil {
+					onError(err)
+				}
+			}
+		}
+		fmt.Println("FileSource has finished.")
+		close(src.Out)
+	}()
+}
+
+// `expandPath` returns the files that a path of `fileSource.Paths` stands
+// for.
+func expandPath(p string) ([]string, error) {
+	if p == "-" {
+		return []string{p}, nil
+	}
+	if strings.ContainsAny(p, `*?[\`) {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %v", p, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", p)
+		}
+		var files []string
+		for _, m := range matches {
+			f, err := expandPath(m)
+			if err != nil {
+				return files, err
+			}
+			files = append(files, f...)
+		}
+		return files, nil
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{p}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// `read` sends the lines or the contents of a single file.
+func (src *fileSource) read(name string) error {
+	var r io.Reader
+	if name == "-" {
+		r = src.Stdin
+		if r == nil {
+			r = os.Stdin
+		}
+	} else {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	if src.Documents {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		src.Out <- string(b)
+		return nil
+	}
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, maxLineLength)
+	for s.Scan() {
+		src.Out <- s.Text()
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if strings.HasSuffix(name, ".gz") {
+			gz := gzip.NewWriter(f)
+			defer gz.Close()
+			gz.Write([]byte(content))
+			return
+		}
+		f.WriteString(content)
+	}
+	write("a.txt", "Life is too\nimportant.\n")
+	write("docs/b.txt", "Why?\r\n\r\nBecause.")
+	write("docs/deeper/c.txt.gz", "Compressed.\n")
+	write("d.md", "# Not text\n")
+
+	tests := []struct {
+		name      string
+		node      *fileSource
+		want      []interface{}
+		wantError string
+	}{
+		{"file", &fileSource{Paths: []string{filepath.Join(dir, "a.txt")}},
+			[]interface{}{"Life is too", "important."}, ""},
+		{"directory", &fileSource{Paths: []string{filepath.Join(dir, "docs")}},
+			[]interface{}{"Why?", "", "Because.", "Compressed."}, ""},
+		{"glob", &fileSource{Paths: []string{filepath.Join(dir, "*.txt"), filepath.Join(dir, "*", "*", "*.gz")}},
+			[]interface{}{"Life is too", "important.", "Compressed."}, ""},
+		{"documents", &fileSource{Paths: []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "docs")}, Documents: true},
+			[]interface{}{"Life is too\nimportant.\n", "Why?\r\n\r\nBecause.", "Compressed.\n"}, ""},
+		{"stdin", &fileSource{Paths: []string{"-"}, Stdin: strings.NewReader("From stdin.\n")},
+			[]interface{}{"From stdin."}, ""},
+		{"missing file", &fileSource{Paths: []string{filepath.Join(dir, "missing.txt"), filepath.Join(dir, "a.txt")}},
+			[]interface{}{"Life is too", "important."}, "missing.txt"},
+		{"no match", &fileSource{Paths: []string{filepath.Join(dir, "*.pdf")}},
+			nil, "no files match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs []string
+			tt.node.OnError = func(err error) {
+				errs = append(errs, err.Error())
+			}
+			expect(t, tt.node, ports{}, ports{"Out": tt.want})
+			switch {
+			case tt.wantError == "" && len(errs) > 0:
+				t.Errorf("unexpected errors: %q", errs)
+			case tt.wantError != "" && (len(errs) != 1 || !strings.Contains(errs[0], tt.wantError)):
+				t.Errorf("got errors %q, want one containing %q", errs, tt.wantError)
+			}
+		})
+	}
+}
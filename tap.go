@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// A `tapSink` receives copies of the packets that pass a tapped edge.
+// `writerSink` covers stdout and files, and `websocketSink` sends the
+// packets to browsers; any other destination only needs to implement this
+// interface.
+type tapSink interface {
+	Tap(edge string, at time.Time, packet interface{})
+}
+
+// `writerSink` writes one line per packet to an `io.Writer`.
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func newWriterSink(w io.Writer) *writerSink {
+	return &writerSink{w: w}
+}
+
+func (s *writerSink) Tap(edge string, at time.Time, packet interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.w, "%s %s: %v\n", at.Format("15:04:05.000000"), edge, packet)
+}
+
+// `tapOptions` select which packets a tap copies.
+type tapOptions struct {
+	// If `Filter` is not nil, only packets for which it returns true are
+	// copied.
+	Filter func(packet interface{}) bool
+	// `Rate` is the fraction of the filtered packets that are copied, for
+	// example 0.1 for every tenth packet. Zero means all packets.
+	Rate float64
+	// If `Lossless` is set, the edge waits for a slow sink instead of
+	// dropping packets.
+	Lossless bool
+}
+
+// `matching` returns a filter that accepts packets whose printed form
+// matches the regular expression `expr`.
+func matching(expr string) (func(interface{}) bool, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return func(p interface{}) bool {
+		return re.MatchString(fmt.Sprint(p))
+	}, nil
+}
+
+// Taps buffer this many packets for a slow sink, and drop packets beyond
+// that rather than slowing down the edge.
+const tapBuffer = 100
+
+type tapped struct {
+	edge   string
+	at     time.Time
+	packet interface{}
+}
+
+// A `tap` copies the packets that pass an edge to a sink. The sink runs in
+// a goroutine of its own, so it only blocks the edge if it is lossless and
+// its buffer is full.
+type tap struct {
+	sink tapSink
+	opts tapOptions
+
+	mu      sync.Mutex
+	credit  float64
+	dropped uint64
+	closed  bool
+	// `sending` counts the lossless sends that wait for room in `packets`.
+	// They wait outside `mu`, so that `untap` can return the number of
+	// dropped packets while the sink is slow.
+	sending sync.WaitGroup
+
+	packets chan tapped
+	done    chan struct{}
+}
+
+func newTap(sink tapSink, opts tapOptions) *tap {
+	t := &tap{
+		sink:    sink,
+		opts:    opts,
+		packets: make(chan tapped, tapBuffer),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		for p := range t.packets {
+			t.sink.Tap(p.edge, p.at, p.packet)
+		}
+		close(t.done)
+	}()
+	return t
+}
+
+// `offer` is called by the edge for every packet that enters it.
+func (t *tap) offer(edge string, at time.Time, packet interface{}) {
+	if t.opts.Filter != nil && !t.opts.Filter(packet) {
+		return
+	}
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	if t.opts.Rate > 0 && t.opts.Rate < 1 {
+		// Spread the sampled packets evenly: every packet earns a bit of
+		// credit, and a packet is copied whenever the credit adds up to one.
+		t.credit += t.opts.Rate
+		if t.credit < 1 {
+			t.mu.Unlock()
+			return
+		}
+		t.credit--
+	}
+	p := tapped{edge, at, packet}
+	if t.opts.Lossless {
+		t.sending.Add(1)
+		t.mu.Unlock()
+		t.packets <- p
+		t.sending.Done()
+		return
+	}
+	select {
+	case t.packets <- p:
+	default:
+		t.dropped++
+	}
+	t.mu.Unlock()
+}
+
+// `close` stops the tap after the sink has received all buffered packets.
+func (t *tap) close() {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	t.sending.Wait()
+	close(t.packets)
+	<-t.done
+}
+
+// `Tap` attaches a tap to the edge with the given name, while the network is
+// running. The flow through the edge is not affected. Call `untap` to remove
+// the tap again; it returns the number of packets that were dropped because
+// the sink could not keep up.
+func (n *network) Tap(edge string, sink tapSink, opts tapOptions) (untap func() (dropped uint64), err error) {
+	l := n.edge(edge)
+	if l == nil {
+		return nil, fmt.Errorf("cannot tap %q: no such edge", edge)
+	}
+	t := newTap(sink, opts)
+	l.addTap(t)
+	var once sync.Once
+	return func() uint64 {
+		once.Do(func() {
+			l.removeTap(t)
+			t.close()
+		})
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return t.dropped
+	}, nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// `slowSink` holds up the tap at the first packet until `release` is
+// closed.
+type slowSink struct {
+	entered chan struct{}
+	release chan struct{}
+	once    sync.Once
+
+	mu  sync.Mutex
+	got []interface{}
+}
+
+func newSlowSink() *slowSink {
+	return &slowSink{entered: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (s *slowSink) Tap(edge string, at time.Time, packet interface{}) {
+	s.once.Do(func() { close(s.entered) })
+	<-s.release
+	s.mu.Lock()
+	s.got = append(s.got, packet)
+	s.mu.Unlock()
+}
+
+func (s *slowSink) packets() []interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.got
+}
+
+// `tapEdge` returns an edge whose output is drained into `out`.
+func tapEdge(t *testing.T) (*network, *edge[int], chan []int) {
+	t.Helper()
+	n := newNetwork()
+	e := newEdge[int](n, "e", 2)
+	out := make(chan []int, 1)
+	go func() {
+		var got []int
+		for i := range e.Out() {
+			got = append(got, i)
+		}
+		out <- got
+	}()
+	return n, e, out
+}
+
+func sendInts(e *edge[int], from, to int) {
+	for i := from; i < to; i++ {
+		e.In() <- i
+	}
+}
+
+func TestTapLossy(t *testing.T) {
+	n, e, out := tapEdge(t)
+	sink := newSlowSink()
+	untap, err := n.Tap("e", sink, tapOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.In() <- 0
+	<-sink.entered
+	// The sink is stuck at the first packet, so the tap buffers the next
+	// `tapBuffer` packets and drops the rest, but the edge keeps flowing.
+	sendInts(e, 1, tapBuffer+6)
+	close(e.In())
+	if got := <-out; len(got) != tapBuffer+6 {
+		t.Errorf("the edge delivered %d packets, want %d", len(got), tapBuffer+6)
+	}
+	close(sink.release)
+	if dropped := untap(); dropped != 5 {
+		t.Errorf("dropped %d packets, want 5", dropped)
+	}
+	if got := sink.packets(); len(got) != tapBuffer+1 || got[0] != 0 || got[tapBuffer] != tapBuffer {
+		t.Errorf("the sink got %d packets, want the first %d", len(got), tapBuffer+1)
+	}
+}
+
+func TestTapLossless(t *testing.T) {
+	n, e, out := tapEdge(t)
+	sink := newSlowSink()
+	untap, err := n.Tap("e", sink, tapOptions{Lossless: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.In() <- 0
+	<-sink.entered
+	go func() {
+		sendInts(e, 1, tapBuffer+6)
+		close(e.In())
+	}()
+	// The edge waits for the sink. Untapping meanwhile must not deadlock:
+	// it waits for the packets on their way to the sink, and the sink
+	// gets them all.
+	waitFor(t, "the edge waits for the tap", func() bool {
+		for _, g := range goroutines() {
+			if g.State == "chan send" && strings.Contains(g.Stack, "(*tap).offer") {
+				return true
+			}
+		}
+		return false
+	})
+	dropped := make(chan uint64)
+	go func() {
+		dropped <- untap()
+	}()
+	close(sink.release)
+	if d := <-dropped; d != 0 {
+		t.Errorf("dropped %d packets, want 0", d)
+	}
+	got := sink.packets()
+	for i, p := range got {
+		if p != i {
+			t.Fatalf("the sink got packet %v at %d", p, i)
+		}
+	}
+	// Untapping stops the copies, not the flow.
+	if len(got) < tapBuffer+2 {
+		t.Errorf("the sink got %d packets, want at least %d", len(got), tapBuffer+2)
+	}
+	if got := <-out; len(got) != tapBuffer+6 {
+		t.Errorf("the edge delivered %d packets, want %d", len(got), tapBuffer+6)
+	}
+}
+
+func TestTapFilterAndRate(t *testing.T) {
+	n, e, out := tapEdge(t)
+	var b bytes.Buffer
+	filter, err := matching("^[0-9]$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	untap, err := n.Tap("e", newWriterSink(&b), tapOptions{Filter: filter, Rate: 0.5, Lossless: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendInts(e, 0, 20)
+	close(e.In())
+	<-out
+	untap()
+	untap()
+
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		// Lines look like "12:00:00.000000 e: 1".
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[1] != "e:" {
+			t.Fatalf("unexpected line %q", line)
+		}
+		got = append(got, fields[2])
+	}
+	if strings.Join(got, " ") != "1 3 5 7 9" {
+		t.Errorf("got %v, want every second single digit", got)
+	}
+
+	if _, err := n.Tap("nope", newWriterSink(&b), tapOptions{}); err == nil || !strings.Contains(err.Error(), `"nope"`) {
+		t.Errorf("got %v, want an error for the missing edge", err)
+	}
+	if _, err := matching("("); err == nil {
+		t.Error("want an error for a bad regexp")
+	}
+}
+
+func TestWebSocketSink(t *testing.T) {
+	n, e, out := tapEdge(t)
+	e.Connect("lc", "Count", "p", "Line2")
+	sink, srv, err := ServeWebSocketTaps(n, "counts", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws://"+srv.Addr+"/taps", http.Header{"Sec-WebSocket-Protocol": {"noflo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if resp.Header.Get("Sec-WebSocket-Protocol") != "noflo" {
+		t.Errorf("got subprotocol %q, want noflo", resp.Header.Get("Sec-WebSocket-Protocol"))
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	// Clients ask what they are talking to first.
+	if err := conn.WriteJSON(map[string]interface{}{"protocol": "runtime", "command": "getruntime", "payload": map[string]string{}}); err != nil {
+		t.Fatal(err)
+	}
+	var rt struct {
+		Protocol, Command string
+		Payload           struct {
+			Type, Graph  string
+			Capabilities []string
+		}
+	}
+	if err := conn.ReadJSON(&rt); err != nil {
+		t.Fatal(err)
+	}
+	if rt.Protocol != "runtime" || rt.Command != "runtime" || rt.Payload.Type != "flow2go" || rt.Payload.Graph != "counts" {
+		t.Errorf("got %+v, want the runtime info", rt)
+	}
+
+	untap, err := n.Tap("e", sink, tapOptions{Lossless: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.In() <- 42
+	close(e.In())
+	<-out
+	untap()
+
+	var data struct {
+		Protocol, Command string
+		Payload           struct {
+			ID, Graph string
+			Src, Tgt  struct{ Node, Port string }
+			Data      int
+		}
+	}
+	if err := conn.ReadJSON(&data); err != nil {
+		t.Fatal(err)
+	}
+	p := data.Payload
+	if data.Protocol != "network" || data.Command != "data" || p.ID != "lc.Count -> p.Line2" || p.Graph != "counts" ||
+		p.Src.Node != "lc" || p.Src.Port != "Count" || p.Tgt.Node != "p" || p.Tgt.Port != "Line2" || p.Data != 42 {
+		t.Errorf("got %+v, want the packet as network:data", data)
+	}
+
+	// The sink drops clients that close the connection.
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	waitFor(t, "the sink drops the client", func() bool {
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		return len(sink.clients) == 0
+	})
+
+	resp, err = http.Get("http://" + srv.Addr + "/taps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("a plain GET got %s, want 400", resp.Status)
+	}
+}
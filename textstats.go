@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// This file contains more counters for text statistics. They all have the
+// same shape as `wordCounter` and `letterCounter`: they read sentences from
+// `Sentence`, send one `count` per sentence to `Count`, and close `Count`
+// when `Sentence` is closed. So any of them can replace a counter in the
+// network, or be added next to them with another splitter and printer.
+//
+// `count` holds an integer, so the averages and the readability score are
+// sent in hundredths, with a `scale` of 100. A word length of 4.5 letters
+// arrives as 450, and prints as 4.50.
+
+// `countEach` is the loop that all counters share. Each counter starts it in
+// a goroutine of its own, so that the watchdog can tell the counters apart.
+func countEach(name string, in <-chan string, out chan<- *count, tag string, scale int, measure func(string) int) {
+	for sentence := range in {
+		out <- &count{tag, measure(sentence), scale}
+	}
+	fmt.Println(name + " has finished.")
+	close(out)
+}
+
+// `charCounter` counts the characters (that is, the runes) of a sentence,
+// including spaces and punctuation.
+type charCounter struct {
+	Sentence <-chan string
+	Count    chan<- *count
+}
+
+func (c *charCounter) Process() {
+	fmt.Println("CharCounter starts.")
+	go func() {
+		countEach("CharCounter", c.Sentence, c.Count, "Characters", 1, utf8.RuneCountInString)
+	}()
+}
+
+// `sentenceCounter` counts the sentences in a string. This is useful if the
+// network reads whole paragraphs or lines rather than single sentences.
+type sentenceCounter struct {
+	Sentence <-chan string
+	Count    chan<- *count
+}
+
+func (c *sentenceCounter) Process() {
+	fmt.Println("SentenceCounter starts.")
+	go func() {
+		countEach("SentenceCounter", c.Sentence, c.Count, "Sentences", 1, sentences)
+	}()
+}
+
+// `syllableCounter` estimates the number of syllables of the words in a
+// sentence. See `syllables` for how.
+type syllableCounter struct {
+	Sentence <-chan string
+	Count    chan<- *count
+}
+
+func (c *syllableCounter) Process() {
+	fmt.Println("SyllableCounter starts.")
+	go func() {
+		countEach("SyllableCounter", c.Sentence, c.Count, "Syllables", 1, func(s string) int {
+			n := 0
+			for _, w := range wordBoundaries(s) {
+				n += syllables(w)
+			}
+			return n
+		})
+	}()
+}
+
+// `punctuationCounter` counts the punctuation characters of a sentence.
+type punctuationCounter struct {
+	Sentence <-chan string
+	Count    chan<- *count
+}
+
+func (c *punctuationCounter) Process() {
+	fmt.Println("PunctuationCounter starts.")
+	go func() {
+		countEach("PunctuationCounter", c.Sentence, c.Count, "Punctuation", 1, func(s string) int {
+			return countRunes(s, unicode.IsPunct)
+		})
+	}()
+}
+
+// `vowelCounter` counts the vowels of a sentence, and `consonantCounter` the
+// consonants. Both only know about the Latin script; letters of other scripts
+// count as neither. "y" counts as a consonant.
+type vowelCounter struct {
+	Sentence <-chan string
+	Count    chan<- *count
+}
+
+func (c *vowelCounter) Process() {
+	fmt.Println("VowelCounter starts.")
+	go func() {
+		countEach("VowelCounter", c.Sentence, c.Count, "Vowels", 1, func(s string) int {
+			return countRunes(s, isVowel)
+		})
+	}()
+}
+
+type consonantCounter struct {
+	Sentence <-chan string
+	Count    chan<- *count
+}
+
+func (c *consonantCounter) Process() {
+	fmt.Println("ConsonantCounter starts.")
+	go func() {
+		countEach("ConsonantCounter", c.Sentence, c.Count, "Consonants", 1, func(s string) int {
+			return countRunes(s, isConsonant)
+		})
+	}()
+}
+
+// `wordLengthAverager` sends the average number of letters per word, in
+// hundredths.
+type wordLengthAverager struct {
+	Sentence <-chan string
+	Count    chan<- *count
+}
+
+func (c *wordLengthAverager) Process() {
+	fmt.Println("WordLengthAverager starts.")
+	go func() {
+		countEach("WordLengthAverager", c.Sentence, c.Count, "Average word length", 100, func(s string) int {
+			words := wordBoundaries(s)
+			if len(words) == 0 {
+				return 0
+			}
+			letters := 0
+			for _, w := range words {
+				letters += countRunes(w, unicode.IsLetter)
+			}
+			return hundredths(float64(letters) / float64(len(words)))
+		})
+	}()
+}
+
+// `readabilityScorer` sends the Flesch-Kincaid grade level of a sentence, in
+// hundredths. The grade level estimates how many years of school a reader
+// needs to understand a text:
+//
+//	0.39 * words/sentences + 11.8 * syllables/words - 15.59
+//
+// The formula was made for English, and it is meant for whole texts. For a
+// single short sentence, the result can be below zero.
+type readabilityScorer struct {
+	Sentence <-chan string
+	Count    chan<- *count
+}
+
+func (c *readabilityScorer) Process() {
+	fmt.Println("ReadabilityScorer starts.")
+	go func() {
+		countEach("ReadabilityScorer", c.Sentence, c.Count, "Flesch-Kincaid grade", 100, fleschKincaid)
+	}()
+}
+
+func fleschKincaid(s string) int {
+	words := wordBoundaries(s)
+	if len(words) == 0 {
+		return 0
+	}
+	syl := 0
+	for _, w := range words {
+		syl += syllables(w)
+	}
+	w := float64(len(words))
+	// Words without letters or digits, like "_", make no sentence, but the
+	// text is one nevertheless.
+	grade := 0.39*w/float64(max(sentences(s), 1)) + 11.8*float64(syl)/w - 15.59
+	return hundredths(grade)
+}
+
+func hundredths(f float64) int {
+	return int(math.Round(f * 100))
+}
+
+func countRunes(s string, f func(rune) bool) int {
+	n := 0
+	for _, r := range s {
+		if f(r) {
+			n++
+		}
+	}
+	return n
+}
+
+func isVowel(r rune) bool {
+	return strings.ContainsRune("aeiouàáâãäåæèéêëìíîïòóôõöøœùúûü", unicode.ToLower(r))
+}
+
+func isConsonant(r rune) bool {
+	return unicode.Is(unicode.Latin, r) && unicode.IsLetter(r) && !isVowel(r)
+}
+
+func isTerminal(r rune) bool {
+	return strings.ContainsRune(".!?…。！？", r)
+}
+
+// `sentences` counts the sentences in `s`. A sentence ends with one or more
+// of ".", "!", "?", or "…", followed by a space or the end of the string; so
+// "3.14" does not end a sentence, and "What?!" ends only one. Text without
+// any of these at the end still counts as a sentence, as long as it
+// contains a letter or digit.
+func sentences(s string) int {
+	n := 0
+	content := false
+	for i, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			content = true
+			continue
+		}
+		if !content || !isTerminal(r) {
+			continue
+		}
+		next, _ := utf8.DecodeRuneInString(s[i+utf8.RuneLen(r):])
+		if i+utf8.RuneLen(r) == len(s) || unicode.IsSpace(next) || strings.ContainsRune(`"')]”’»`, next) {
+			n++
+			content = false
+		}
+	}
+	if content {
+		n++
+	}
+	return n
+}
+
+// `syllables` estimates the number of syllables of an English word: each
+// group of consecutive vowels (including "y") is a syllable, except for a
+// silent "e" at the end, as in "make" (but not in "table"). Every word has at
+// least one syllable. This is wrong for words like "seriously" (3 instead of
+// 4), but good enough for readability scores.
+func syllables(word string) int {
+	w := strings.ToLower(word)
+	n := 0
+	inVowels := false
+	for _, r := range w {
+		v := isVowel(r) || r == 'y'
+		if v && !inVowels {
+			n++
+		}
+		inVowels = v
+	}
+	if n > 1 && strings.HasSuffix(w, "e") && !strings.HasSuffix(w, "le") && !strings.HasSuffix(w, "ee") {
+		n--
+	}
+	if n == 0 {
+		return 1
+	}
+	return n
+}
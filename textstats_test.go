@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestTextStats(t *testing.T) {
+	const life = "Life is too important to be taken seriously."
+	tests := []struct {
+		name string
+		node processor
+		in   string
+		want *count
+	}{
+		{"charCounter", &charCounter{}, life, &count{"Characters", 44, 1}},
+		{"charCounter with umlauts", &charCounter{}, "Größe", &count{"Characters", 5, 1}},
+		{"sentenceCounter", &sentenceCounter{}, life, &count{"Sentences", 1, 1}},
+		{"sentenceCounter with paragraph", &sentenceCounter{}, `Pi is 3.14. Really?! "Yes." No`, &count{"Sentences", 4, 1}},
+		{"sentenceCounter with empty sentence", &sentenceCounter{}, " ... ", &count{"Sentences", 0, 1}},
+		{"syllableCounter", &syllableCounter{}, life, &count{"Syllables", 13, 1}},
+		{"punctuationCounter", &punctuationCounter{}, "Don't panic - really?!", &count{"Punctuation", 4, 1}},
+		{"vowelCounter", &vowelCounter{}, life, &count{"Vowels", 16, 1}},
+		{"consonantCounter", &consonantCounter{}, life, &count{"Consonants", 20, 1}},
+		{"vowelCounter with umlauts", &vowelCounter{}, "Größe Жизнь", &count{"Vowels", 2, 1}},
+		{"consonantCounter with umlauts", &consonantCounter{}, "Größe Жизнь", &count{"Consonants", 3, 1}},
+		{"wordLengthAverager", &wordLengthAverager{}, life, &count{"Average word length", 450, 100}},
+		{"wordLengthAverager with empty sentence", &wordLengthAverager{}, "", &count{"Average word length", 0, 100}},
+		{"readabilityScorer", &readabilityScorer{}, life, &count{"Flesch-Kincaid grade", 671, 100}},
+		{"readabilityScorer with empty sentence", &readabilityScorer{}, "", &count{"Flesch-Kincaid grade", 0, 100}},
+		{"readabilityScorer without sentence", &readabilityScorer{}, "_", &count{"Flesch-Kincaid grade", -340, 100}},
+		{"readabilityScorer with dashes", &readabilityScorer{}, "--", &count{"Flesch-Kincaid grade", 0, 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expect(t, tt.node, ports{"Sentence": {tt.in}}, ports{"Count": {tt.want}})
+		})
+	}
+}
+
+func TestSyllables(t *testing.T) {
+	for word, want := range map[string]int{
+		"the":         1,
+		"make":        1,
+		"table":       2,
+		"free":        1,
+		"syllable":    3,
+		"readability": 5,
+		"quickly":     2,
+		"Eye":         1,
+		"42":          1,
+	} {
+		if got := syllables(word); got != want {
+			t.Errorf("syllables(%q) = %d, want %d", word, got, want)
+		}
+	}
+}
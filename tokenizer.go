@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"unicode"
+)
+
+// Tokenizers for `wordCounter.Tokenize`. Besides these, `strings.Fields`
+// works as a tokenizer that splits at whitespace, and it is the default.
+
+// `regexpTokenizer` returns a tokenizer that finds all matches of the
+// regular expression `expr`, for example `\p{L}+` for runs of letters.
+func regexpTokenizer(expr string) (func(string) []string, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("tokenizer: %v", err)
+	}
+	return func(s string) []string {
+		return re.FindAllString(s, -1)
+	}, nil
+}
+
+// The classes of runes that the word boundary rules of Unicode Standard
+// Annex #29 distinguish.
+type wordClass int
+
+const (
+	wcOther wordClass = iota
+	wcLetter
+	wcDigit
+	// Each ideograph, and each Hiragana character, is a word of its own.
+	wcIdeograph
+	wcKatakana
+	// Connector punctuation like "_" joins letters and digits.
+	wcExtendNumLet
+	// Punctuation that may appear inside a word, between letters ("can't",
+	// "e.g") or between digits ("3.14", "1,000").
+	wcMidLetter
+	wcMidNum
+	wcMidNumLet
+	// Combining marks and joiners belong to the rune before them.
+	wcExtend
+)
+
+func classify(r rune) wordClass {
+	switch {
+	case unicode.Is(unicode.Han, r), unicode.Is(unicode.Hiragana, r):
+		return wcIdeograph
+	case unicode.Is(unicode.Katakana, r):
+		return wcKatakana
+	case unicode.IsLetter(r):
+		return wcLetter
+	case unicode.IsDigit(r):
+		return wcDigit
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc), r == '\u200d':
+		return wcExtend
+	case unicode.Is(unicode.Pc, r):
+		return wcExtendNumLet
+	}
+	switch r {
+	case ':', '·', '·', '״', '‧', '︓', '﹕', '：':
+		return wcMidLetter
+	case ',', ';', ';', '։', '،', '؍', '٬', '߸', '⁄', '︐', '︔', '﹐', '﹔', '，', '；':
+		return wcMidNum
+	case '.', '\'', '‘', '’', '․', '﹒', '＇', '．':
+		return wcMidNumLet
+	}
+	return wcOther
+}
+
+// `wordBoundaries` splits a string into words according to the default word
+// boundary rules of Unicode Standard Annex #29, and drops the segments
+// between the words, like spaces and punctuation. Unlike splitting at
+// whitespace, it keeps "can't" and "3.14" together, splits "end.Next" and
+// "well-known", and treats every Chinese or Japanese ideograph as a word.
+//
+// This is a simplified implementation: it does not handle emoji sequences,
+// regional indicators, or the special rules for Hebrew letters.
+func wordBoundaries(s string) []string {
+	type char struct {
+		pos   int
+		class wordClass
+	}
+	var chars []char
+	for i, r := range s {
+		c := classify(r)
+		// WB4: marks and joiners take the class of the rune before them.
+		if c == wcExtend && len(chars) > 0 {
+			continue
+		}
+		chars = append(chars, char{i, c})
+	}
+	class := func(i int) wordClass {
+		if i < 0 || i >= len(chars) {
+			return wcOther
+		}
+		return chars[i].class
+	}
+	isAHLetter := func(c wordClass) bool { return c == wcLetter }
+	isWordChar := func(c wordClass) bool {
+		return c == wcLetter || c == wcDigit || c == wcKatakana || c == wcExtendNumLet
+	}
+	// `joins` reports whether there is no word boundary between chars i and
+	// i+1.
+	joins := func(i int) bool {
+		a, b := class(i), class(i+1)
+		switch {
+		// WB5, WB8, WB9, WB10: letters and digits in any order.
+		case (a == wcLetter || a == wcDigit) && (b == wcLetter || b == wcDigit):
+			return true
+		// WB6, WB7: letter (MidLetter | MidNumLet) letter.
+		case isAHLetter(a) && (b == wcMidLetter || b == wcMidNumLet) && isAHLetter(class(i+2)):
+			return true
+		case (a == wcMidLetter || a == wcMidNumLet) && isAHLetter(b) && isAHLetter(class(i-1)):
+			return true
+		// WB11, WB12: digit (MidNum | MidNumLet) digit.
+		case a == wcDigit && (b == wcMidNum || b == wcMidNumLet) && class(i+2) == wcDigit:
+			return true
+		case (a == wcMidNum || a == wcMidNumLet) && b == wcDigit && class(i-1) == wcDigit:
+			return true
+		// WB13: Katakana.
+		case a == wcKatakana && b == wcKatakana:
+			return true
+		// WB13a, WB13b: connector punctuation.
+		case isWordChar(a) && b == wcExtendNumLet, a == wcExtendNumLet && isWordChar(b):
+			return true
+		}
+		return false
+	}
+
+	var words []string
+	start := 0
+	for i := range chars {
+		if i+1 < len(chars) && joins(i) {
+			continue
+		}
+		end := len(s)
+		if i+1 < len(chars) {
+			end = chars[i+1].pos
+		}
+		// Only segments that start with a word character are words.
+		if c := chars[start].class; c != wcOther && c != wcMidLetter && c != wcMidNum && c != wcMidNumLet && c != wcExtend {
+			words = append(words, s[chars[start].pos:end])
+		}
+		start = i + 1
+	}
+	return words
+}
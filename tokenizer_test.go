@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenizers(t *testing.T) {
+	words, err := regexpTokenizer(`\p{L}+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		tokenize func(string) []string
+		in       string
+		want     []string
+	}{
+		{"boundaries: empty", wordBoundaries, "", nil},
+		{"boundaries: only punctuation", wordBoundaries, " -- !", nil},
+		{"fields: whitespace", strings.Fields, " Hello,  world!\tBye\n", []string{"Hello,", "world!", "Bye"}},
+		{"boundaries: punctuation", wordBoundaries, "Hello,  world! Bye.", []string{"Hello", "world", "Bye"}},
+		{"boundaries: apostrophe", wordBoundaries, "Don't panic.", []string{"Don't", "panic"}},
+		{"boundaries: numbers", wordBoundaries, "Pi is 3.14, or 1,000/318.", []string{"Pi", "is", "3.14", "or", "1,000", "318"}},
+		{"boundaries: hyphen", wordBoundaries, "well-known", []string{"well", "known"}},
+		{"boundaries: umlauts", wordBoundaries, "Größe ändert sich", []string{"Größe", "ändert", "sich"}},
+		{"boundaries: combining marks", wordBoundaries, "café olé", []string{"café", "olé"}},
+		{"boundaries: Japanese", wordBoundaries, "日本語のテキスト", []string{"日", "本", "語", "の", "テキスト"}},
+		{"boundaries: Cyrillic", wordBoundaries, "Жизнь слишком важна.", []string{"Жизнь", "слишком", "важна"}},
+		{"boundaries: underscore", wordBoundaries, "snake_case _x", []string{"snake_case", "_x"}},
+		{"boundaries: R2-D2", wordBoundaries, "R2-D2 met C-3PO in 1977.", []string{"R2", "D2", "met", "C", "3PO", "in", "1977"}},
+		{"regexp: letters", words, "R2-D2 ist größer.", []string{"R", "D", "ist", "größer"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.tokenize(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := regexpTokenizer("("); err == nil {
+		t.Error("regexpTokenizer accepted an invalid expression")
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// `traceContext` travels with every packet through the edges of a traced
+// network. A packet from outside the network starts a new trace; a packet
+// sent by a node points to the span of the node's input packet that it
+// derives from.
+type traceContext struct {
+	TraceID string
+	parent  *span
+}
+
+// A `span` records how a node handled a single packet: when the packet
+// entered the edge to the node's input port, when the node took it, and when
+// the node sent its last packet derived from it.
+type span struct {
+	TraceID  string    `json:"traceId"`
+	SpanID   string    `json:"spanId"`
+	ParentID string    `json:"parentSpanId,omitempty"`
+	Node     string    `json:"node"`
+	Port     string    `json:"port"`
+	Edge     string    `json:"edge"`
+	Enqueued time.Time `json:"enqueued"`
+	Dequeued time.Time `json:"dequeued"`
+	End      time.Time `json:"end"`
+
+	parent *span
+}
+
+// `Waiting` is the time the packet spent in the edge.
+func (s span) Waiting() time.Duration {
+	return s.Dequeued.Sub(s.Enqueued)
+}
+
+// `Processing` is the time the node spent on the packet. For sink nodes,
+// which send nothing, this is always zero.
+func (s span) Processing() time.Duration {
+	return s.End.Sub(s.Dequeued)
+}
+
+// `traceID` returns the trace ID of the span, which it inherits from its
+// parent. It is empty while the parent has not been filled in yet.
+func (s *span) traceID() string {
+	for ; s != nil; s = s.parent {
+		if s.TraceID != "" {
+			return s.TraceID
+		}
+	}
+	return ""
+}
+
+// A `spanExporter` receives every finished span.
+type spanExporter interface {
+	ExportSpan(s span) error
+}
+
+// `tracer` follows the packets through the network.
+//
+// Nodes do not know about trace contexts, and the edges around a node see
+// the node's packets in separate goroutines, so the order in which they
+// report them is not reliable. Instead, the tracer counts: the n-th packet
+// that a node sends to an output edge derives from the n-th packet the node
+// has taken. This only holds for nodes that send one packet per input to
+// each of their outputs, like `splitter` and the counters, which
+// `oneToOne` lists. The tracer does not link the packets of other nodes,
+// like `router`, `segmenter`, or `wordFrequency`, as it would get their
+// parents wrong: their spans end when they take a packet, and the packets
+// they send start new traces.
+type tracer struct {
+	exp spanExporter
+
+	mu    sync.Mutex
+	nodes map[string]*nodeTrace
+	err   error
+}
+
+// `oneToOne` lists the node types whose outputs the tracer links to their
+// inputs; see `tracer`.
+var oneToOne = map[string]bool{
+	"splitter":           true,
+	"wordCounter":        true,
+	"letterCounter":      true,
+	"charCounter":        true,
+	"sentenceCounter":    true,
+	"syllableCounter":    true,
+	"punctuationCounter": true,
+	"vowelCounter":       true,
+	"consonantCounter":   true,
+	"wordLengthAverager": true,
+	"readabilityScorer":  true,
+}
+
+// `nodeTrace` holds the spans of a node that have not been exported yet.
+type nodeTrace struct {
+	// Spans for the node's input packets, starting with packet number
+	// `first`. The edge after the node may report a packet before the edge
+	// before the node has reported the input packet, so spans are created
+	// by whichever comes first.
+	spans    []*span
+	first    int
+	received int
+	sent     map[string]int
+}
+
+// `span` returns the span for the node's input packet number `i`, creating
+// it if necessary, or nil if that span has already been exported.
+func (nt *nodeTrace) span(i int) *span {
+	if i < nt.first {
+		return nil
+	}
+	for len(nt.spans) <= i-nt.first {
+		nt.spans = append(nt.spans, &span{SpanID: newID(8)})
+	}
+	return nt.spans[i-nt.first]
+}
+
+// `finished` removes and returns the spans the node is done with: the node
+// has taken the packet and sent a packet to each of the output edges `outs`,
+// and the span's trace ID is known.
+func (nt *nodeTrace) finished(outs []string) []span {
+	var done []span
+	for len(nt.spans) > 0 && nt.first < nt.received {
+		if len(nt.spans) < maxPending {
+			if nt.spans[0].traceID() == "" {
+				break
+			}
+			for _, e := range outs {
+				if nt.sent[e] <= nt.first {
+					return done
+				}
+			}
+		}
+		done = append(done, nt.spans[0].resolve())
+		nt.spans = nt.spans[1:]
+		nt.first++
+	}
+	return done
+}
+
+// `resolve` returns a copy of the span with trace and parent IDs filled in.
+func (s *span) resolve() span {
+	r := *s
+	r.TraceID = s.traceID()
+	if r.TraceID == "" {
+		r.TraceID = newID(16)
+	}
+	if s.parent != nil {
+		r.ParentID = s.parent.SpanID
+	}
+	r.parent = nil
+	return r
+}
+
+// `Trace` enables tracing for the network. Call it before the first packet
+// enters the network.
+//
+// Traces only follow packets through the node types in `oneToOne`. Packets
+// that any other node sends, like those of `router`, `segmenter`, or
+// `wordFrequency`, start new traces, as the edges cannot tell which input
+// they derive from; see `tracer`.
+func (n *network) Trace(exp spanExporter) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.tracer = &tracer{exp: exp, nodes: map[string]*nodeTrace{}}
+}
+
+// `FlushTraces` exports the spans that are still open, which is at least the
+// last span of every node, and returns the first error of the exporter.
+// Call it after the network has shut down.
+func (n *network) FlushTraces() error {
+	n.mu.Lock()
+	t := n.tracer
+	n.mu.Unlock()
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	var spans []span
+	for _, nt := range t.nodes {
+		for i, s := range nt.spans {
+			if nt.first+i < nt.received {
+				spans = append(spans, s.resolve())
+			}
+		}
+		nt.first += len(nt.spans)
+		nt.spans = nil
+	}
+	t.mu.Unlock()
+
+	t.export(spans)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+func (t *tracer) export(spans []span) {
+	for _, s := range spans {
+		if err := t.exp.ExportSpan(s); err != nil {
+			t.mu.Lock()
+			if t.err == nil {
+				t.err = err
+			}
+			t.mu.Unlock()
+		}
+	}
+}
+
+// `node` returns the trace state of a node. The caller must hold `t.mu`.
+func (t *tracer) node(name string) *nodeTrace {
+	nt, ok := t.nodes[name]
+	if !ok {
+		nt = &nodeTrace{sent: map[string]int{}}
+		t.nodes[name] = nt
+	}
+	return nt
+}
+
+// `sent` returns the trace context for a packet that `node` sends to
+// `edge`.
+func (t *tracer) sent(node, edge string, at time.Time) traceContext {
+	if node == "" {
+		return traceContext{TraceID: newID(16)}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	nt := t.node(node)
+	s := nt.span(nt.sent[edge])
+	nt.sent[edge]++
+	if s == nil {
+		return traceContext{TraceID: newID(16)}
+	}
+	if at.After(s.End) {
+		s.End = at
+	}
+	return traceContext{parent: s}
+}
+
+// `received` fills in the span for the packet that a node has just taken,
+// and exports the spans that the node is done with. `outs` are the names of
+// the node's output edges, or nil if the tracer does not link the node's
+// packets.
+func (t *tracer) received(to port, edge string, at time.Time, tc traceContext, enqueued time.Time, outs []string) {
+	t.mu.Lock()
+	nt := t.node(to.Node)
+	s := nt.span(nt.received)
+	nt.received++
+	s.TraceID = tc.TraceID
+	s.parent = tc.parent
+	s.Node = to.Node
+	s.Port = to.Port
+	s.Edge = edge
+	s.Enqueued = enqueued
+	s.Dequeued = at
+	if s.End.Before(at) {
+		s.End = at
+	}
+	done := nt.finished(outs)
+	t.mu.Unlock()
+
+	t.export(done)
+}
+
+// `newID` returns a random ID of `n` bytes in hex, the format that OTLP uses
+// for trace and span IDs.
+func newID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// `jsonExporter` writes each span as a JSON object on a line of its own.
+type jsonExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newJSONExporter(w io.Writer) *jsonExporter {
+	return &jsonExporter{enc: json.NewEncoder(w)}
+}
+
+func (e *jsonExporter) ExportSpan(s span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Encode(s)
+}
+
+// `memoryExporter` collects spans in memory, for inspection in tests or for
+// handing them over to OpenTelemetry tools via `WriteOTLP`.
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []span
+}
+
+func (e *memoryExporter) ExportSpan(s span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, s)
+	return nil
+}
+
+// `Spans` returns the spans exported so far.
+func (e *memoryExporter) Spans() []span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]span(nil), e.spans...)
+}
+
+// The subset of the OTLP/JSON trace format that `WriteOTLP` needs.
+type (
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope struct {
+			Name string `json:"name"`
+		} `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes"`
+		Events            []otlpEvent     `json:"events"`
+	}
+	otlpAttribute struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+		} `json:"value"`
+	}
+	otlpEvent struct {
+		TimeUnixNano string `json:"timeUnixNano"`
+		Name         string `json:"name"`
+	}
+)
+
+func otlpString(key, value string) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	a.Value.StringValue = value
+	return a
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// `WriteOTLP` writes the collected spans in the OTLP/JSON format. A span
+// starts when the packet enters the edge and ends with the node's last
+// output; the time the node took the packet is recorded as an event.
+func (e *memoryExporter) WriteOTLP(w io.Writer) error {
+	var ss otlpScopeSpans
+	ss.Scope.Name = "flow2go"
+	for _, s := range e.Spans() {
+		ss.Spans = append(ss.Spans, otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentID,
+			Name:              s.Node,
+			Kind:              1, // SPAN_KIND_INTERNAL
+			StartTimeUnixNano: otlpTime(s.Enqueued),
+			EndTimeUnixNano:   otlpTime(s.End),
+			Attributes: []otlpAttribute{
+				otlpString("flow2go.node", s.Node),
+				otlpString("flow2go.port", s.Port),
+				otlpString("flow2go.edge", s.Edge),
+			},
+			Events: []otlpEvent{{otlpTime(s.Dequeued), "dequeued"}},
+		})
+	}
+	traces := otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttribute{otlpString("service.name", "flow2go")}},
+		ScopeSpans: []otlpScopeSpans{ss},
+	}}}
+	return json.NewEncoder(w).Encode(traces)
+}
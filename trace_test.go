@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appliedgo/flow2go/internal/graph"
+)
+
+// `runTraced` runs a network built from an FBP graph with tracing, sends
+// `input` to its inport "In", and returns the spans. The graph exports the
+// `Done` port of its printer, so that the test waits for the output.
+func runTraced(t *testing.T, fbp string, input ...string) []span {
+	t.Helper()
+	_, restore := captureStdout(t)
+	defer restore()
+	g, err := graph.ParseFBP(strings.NewReader(fbp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gn, err := buildGraph(g, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := &memoryExporter{}
+	gn.Trace(exp)
+	gn.start()
+	in := gn.Inports["In"].Interface().(chan<- string)
+	for _, s := range input {
+		in <- s
+	}
+	close(in)
+	for _, out := range gn.Outports {
+		for {
+			if _, ok := out.Recv(); !ok {
+				break
+			}
+		}
+	}
+	if err := gn.Wait(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// The edges account for the last packets after handing them over.
+	waitFor(t, "all packets are accounted for", func() bool {
+		for _, s := range gn.EdgeStats() {
+			if s.Received != s.Sent {
+				return false
+			}
+		}
+		return true
+	})
+	if err := gn.FlushTraces(); err != nil {
+		t.Fatal(err)
+	}
+	return exp.Spans()
+}
+
+// `byTrace` groups spans by trace, with the nodes of each trace.
+func byTrace(spans []span) map[string][]span {
+	traces := map[string][]span{}
+	for _, s := range spans {
+		traces[s.TraceID] = append(traces[s.TraceID], s)
+	}
+	return traces
+}
+
+func TestTraceFanOut(t *testing.T) {
+	spans := runTraced(t, `INPORT=s.In:In
+OUTPORT=p.Done:Done
+s(splitter) Out1 -> Sentence wc(wordCounter) Count -> Line1 p(printer)
+s Out2 -> Sentence lc(letterCounter) Count -> Line2 p`,
+		"Why?", "Life is too important to be taken seriously.", "Because.")
+
+	traces := byTrace(spans)
+	if len(traces) != 3 {
+		t.Fatalf("got %d traces, want one per sentence:\n%+v", len(traces), spans)
+	}
+	for id, trace := range traces {
+		nodes := map[string][]span{}
+		for _, s := range trace {
+			nodes[s.Node] = append(nodes[s.Node], s)
+			if s.Enqueued.After(s.Dequeued) || s.Dequeued.After(s.End) {
+				t.Errorf("span of %s: enqueued %v, dequeued %v, end %v", s.Node, s.Enqueued, s.Dequeued, s.End)
+			}
+		}
+		if len(nodes["s"]) != 1 || len(nodes["wc"]) != 1 || len(nodes["lc"]) != 1 || len(nodes["p"]) != 2 {
+			t.Errorf("trace %s: got %+v, want one span each for s, wc and lc, and two for p", id, trace)
+			continue
+		}
+		// Both branches of the splitter derive from the same span.
+		s, wc, lc := nodes["s"][0], nodes["wc"][0], nodes["lc"][0]
+		if s.ParentID != "" || wc.ParentID != s.SpanID || lc.ParentID != s.SpanID {
+			t.Errorf("trace %s: wc and lc have parents %s and %s, want %s", id, wc.ParentID, lc.ParentID, s.SpanID)
+		}
+		for _, p := range nodes["p"] {
+			want := wc
+			if p.Port == "Line2" {
+				want = lc
+			}
+			if p.ParentID != want.SpanID {
+				t.Errorf("trace %s: printer span on %s has parent %s, want %s", id, p.Port, p.ParentID, want.SpanID)
+			}
+		}
+		if wc.Edge != "s.Out1" || wc.Port != "Sentence" {
+			t.Errorf("trace %s: wc span is for %s at %s", id, wc.Port, wc.Edge)
+		}
+	}
+}
+
+// The tracer cannot tell which input packet a router's output derives from,
+// so it does not link them.
+func TestTraceRouter(t *testing.T) {
+	spans := runTraced(t, `INPORT=r.In:In
+OUTPORT=p.Done:Done
+r(router) Out[questions] -> Sentence wc(wordCounter) Count -> Line1 p(printer)
+r Default -> Sentence lc(letterCounter) Count -> Line2 p`,
+		"Why?", "Because.", "How?")
+
+	routerSpans := map[string]bool{}
+	for _, s := range spans {
+		if s.Node == "r" {
+			routerSpans[s.SpanID] = true
+			if s.Processing() != 0 {
+				t.Errorf("router span has processing time %v, want 0", s.Processing())
+			}
+		}
+	}
+	if len(routerSpans) != 3 {
+		t.Errorf("got %d router spans, want 3", len(routerSpans))
+	}
+	counters := 0
+	for _, s := range spans {
+		if routerSpans[s.ParentID] {
+			t.Errorf("span of %s has a router span as parent", s.Node)
+		}
+		if s.Node == "wc" || s.Node == "lc" {
+			counters++
+			if s.ParentID != "" {
+				t.Errorf("span of %s has parent %s, want none", s.Node, s.ParentID)
+			}
+		}
+	}
+	if counters != 3 {
+		t.Errorf("got %d counter spans, want 3", counters)
+	}
+	// Each router span is a trace of its own, and the counters start new
+	// traces that the tracer follows again.
+	for _, trace := range byTrace(spans) {
+		if len(trace) == 1 && trace[0].Node == "r" {
+			continue
+		}
+		if len(trace) != 2 {
+			t.Errorf("want a counter span and a printer span, got %+v", trace)
+			continue
+		}
+		c, p := trace[0], trace[1]
+		if c.Node == "p" {
+			c, p = p, c
+		}
+		if p.Node != "p" || p.ParentID != c.SpanID {
+			t.Errorf("want a counter span with a printer span as child, got %+v", trace)
+		}
+	}
+}
+
+// Segmenters and word frequency counters are not linked either: their spans
+// end when they take a packet, and what they send starts new traces.
+func TestTraceUnlinked(t *testing.T) {
+	for _, tc := range []struct {
+		name, node, fbp string
+		input           []string
+		// The spans of nodes after the unlinked node, which must have no
+		// parent.
+		after int
+	}{
+		{"segmenter", "sg", `INPORT=sg.In:In
+OUTPORT=p.Done:Done
+sg(segmenter) Out -> Sentence wc(wordCounter) Count -> Line1 p(printer)`,
+			[]string{"Why? Because", " it is there. How?"}, 3},
+		{"wordFrequency", "wf", `INPORT=sg.In:In
+OUTPORT=wf.Top:Top
+sg(segmenter) Out -> Sentence wf(wordFrequency)`,
+			[]string{"To be or not to be.", "That is the question."}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spans := runTraced(t, tc.fbp, tc.input...)
+			unlinked := map[string]bool{}
+			for _, s := range spans {
+				if s.Node == tc.node {
+					unlinked[s.SpanID] = true
+					if s.Processing() != 0 {
+						t.Errorf("%s span has processing time %v, want 0", tc.node, s.Processing())
+					}
+				}
+			}
+			if len(unlinked) != len(tc.input) {
+				t.Errorf("got %d %s spans, want %d", len(unlinked), tc.node, len(tc.input))
+			}
+			after := 0
+			for _, s := range spans {
+				if unlinked[s.ParentID] {
+					t.Errorf("span of %s has a %s span as parent", s.Node, tc.node)
+				}
+				if s.Node == "wc" {
+					after++
+					if s.ParentID != "" {
+						t.Errorf("span of wc has parent %s, want none", s.ParentID)
+					}
+				}
+			}
+			if after != tc.after {
+				t.Errorf("got %d spans after %s, want %d", after, tc.node, tc.after)
+			}
+		})
+	}
+}
+
+func TestTraceExporters(t *testing.T) {
+	s := span{TraceID: "t1", SpanID: "s1", ParentID: "s0", Node: "wc", Port: "Sentence", Edge: "sToWc",
+		Enqueued: virtualEpoch, Dequeued: virtualEpoch.Add(time.Millisecond), End: virtualEpoch.Add(3 * time.Millisecond)}
+	if s.Waiting() != time.Millisecond || s.Processing() != 2*time.Millisecond {
+		t.Errorf("got waiting %v and processing %v", s.Waiting(), s.Processing())
+	}
+
+	var b bytes.Buffer
+	if err := newJSONExporter(&b).ExportSpan(s); err != nil {
+		t.Fatal(err)
+	}
+	var got span
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `"parentSpanId":"s0"`) || got.SpanID != "s1" || !got.End.Equal(s.End) {
+		t.Errorf("got %s", b.String())
+	}
+
+	mem := &memoryExporter{}
+	mem.ExportSpan(s)
+	b.Reset()
+	if err := mem.WriteOTLP(&b); err != nil {
+		t.Fatal(err)
+	}
+	var traces otlpTraces
+	if err := json.Unmarshal(b.Bytes(), &traces); err != nil {
+		t.Fatal(err)
+	}
+	spans := traces.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 1 || spans[0].Name != "wc" || spans[0].ParentSpanID != "s0" ||
+		spans[0].StartTimeUnixNano != otlpTime(s.Enqueued) || spans[0].EndTimeUnixNano != otlpTime(s.End) ||
+		spans[0].Events[0].TimeUnixNano != otlpTime(s.Dequeued) {
+		t.Errorf("got OTLP %s", b.String())
+	}
+}
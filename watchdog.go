@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// `watchdogOptions` configure `Watch`.
+type watchdogOptions struct {
+	// How often the watchdog looks at the network. Defaults to 100ms.
+	Interval time.Duration
+	// If no packet moved through any edge for this long, the network counts
+	// as stalled. Zero disables this check.
+	Stall time.Duration
+	// `Report` receives the diagnosis. Defaults to printing it to stderr.
+	Report func(diagnosis)
+	// `Done` is the channel that the network closes when it has finished,
+	// like the printer's `Done` port. If it is set, the watchdog also
+	// reports a network whose nodes have all exited without closing it.
+	Done <-chan struct{}
+}
+
+// A `diagnosis` explains why the watchdog thinks the network hangs.
+type diagnosis struct {
+	Reason string
+	Nodes  []nodeDiagnosis
+	Edges  []edgeStats
+}
+
+// `nodeDiagnosis` describes what a goroutine of a node is waiting for.
+type nodeDiagnosis struct {
+	Node string
+	// The method that started the goroutine, for example "Process" or
+	// "merge".
+	Func string
+	// The goroutine state, or "finished" if the node has no goroutines
+	// left.
+	State string
+	// The ports the goroutine is probably blocked on: full output edges for
+	// a blocked send, empty input edges for a blocked receive.
+	Ports []string
+}
+
+func (d diagnosis) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "network hangs: %s\n", d.Reason)
+	for _, nd := range d.Nodes {
+		name := nd.Node
+		if nd.Func != "" {
+			name += " (" + nd.Func + ")"
+		}
+		fmt.Fprintf(&b, "  %s: %s", name, nd.State)
+		if len(nd.Ports) > 0 {
+			fmt.Fprintf(&b, " on %s", strings.Join(nd.Ports, ", "))
+		}
+		b.WriteByte('\n')
+	}
+	printEdgeStats(&b, d.Edges)
+	return b.String()
+}
+
+// `Watch` starts a watchdog that reports when the network stops making
+// progress, until the returned `stop` function is called. It reports
+//
+//   - a deadlock, if all node goroutines wait for channel operations or for
+//     each other, like the printer's `merge` in `sync.WaitGroup.Wait`, while
+//     an edge is full or all input edges of the network are closed (an empty
+//     network that waits for input is not deadlocked), and
+//   - a stall, if no packet moved for `opts.Stall`, and
+//   - a sink that forgot to close `opts.Done`, if all nodes have exited but
+//     `opts.Done` is still open.
+//
+// Otherwise, a network whose nodes have all exited is not reported.
+//
+// Each incident is reported once; the watchdog reports again only after the
+// network has made progress in between.
+func (n *network) Watch(opts watchdogOptions) (stop func()) {
+	if opts.Interval <= 0 {
+		opts.Interval = 100 * time.Millisecond
+	}
+	if opts.Report == nil {
+		opts.Report = func(d diagnosis) {
+			fmt.Fprint(os.Stderr, d)
+		}
+	}
+
+	var lastMoved uint64
+	lastProgress := time.Now()
+	reported, exited := false, false
+	return n.Monitor(opts.Interval, func(edges []edgeStats) {
+		var moved uint64
+		for _, e := range edges {
+			moved += e.Sent + e.Received
+		}
+		now := time.Now()
+		if moved != lastMoved {
+			lastMoved = moved
+			lastProgress = now
+			reported, exited = false, false
+			return
+		}
+		if reported {
+			return
+		}
+		gs := n.nodeGoroutines()
+		if len(gs) == 0 {
+			// The network has shut down. If `Done` goes through an edge, it
+			// closes a moment after the last node has exited, so it only
+			// counts as forgotten if it is still open the next time.
+			if opts.Done == nil {
+				return
+			}
+			select {
+			case <-opts.Done:
+			default:
+				if exited {
+					opts.Report(n.diagnose("all nodes exited, but Done is still open", edges))
+					reported = true
+				}
+				exited = true
+			}
+			return
+		}
+		exited = false
+		if reason := n.deadlocked(gs, edges); reason != "" {
+			opts.Report(n.diagnose(reason, edges))
+			reported = true
+			return
+		}
+		if opts.Stall > 0 && now.Sub(lastProgress) >= opts.Stall {
+			opts.Report(n.diagnose(fmt.Sprintf("no packet moved for %v", now.Sub(lastProgress).Round(time.Millisecond)), edges))
+			reported = true
+		}
+	})
+}
+
+// `deadlocked` returns the reason why the network with the node goroutines
+// `gs` is deadlocked, or an empty string if it is not.
+func (n *network) deadlocked(gs []goroutineInfo, edges []edgeStats) string {
+	for _, g := range gs {
+		if !g.waiting() {
+			return ""
+		}
+	}
+
+	for _, e := range edges {
+		if e.Len == e.Cap {
+			return fmt.Sprintf("all node goroutines are blocked, and edge %s is full", e.Name)
+		}
+	}
+	inputs, closed := 0, 0
+	for _, l := range n.links() {
+		if from, _ := l.Endpoints(); from.Node == "" {
+			inputs++
+			if l.closed() {
+				closed++
+			}
+		}
+	}
+	if inputs > 0 && inputs == closed {
+		return "all node goroutines are blocked, although the network's input is closed"
+	}
+	return ""
+}
+
+// `diagnose` lists what every goroutine of every node is waiting for.
+func (n *network) diagnose(reason string, edges []edgeStats) diagnosis {
+	d := diagnosis{Reason: reason, Edges: edges}
+	stats := map[string]edgeStats{}
+	for _, e := range edges {
+		stats[e.Name] = e
+	}
+	links := n.links()
+	gs := n.nodeGoroutines()
+
+	n.mu.Lock()
+	nodes := append([]string(nil), n.nodes...)
+	types := map[string]string{}
+	for name, t := range n.nodeTypes {
+		types[name] = t
+	}
+	n.mu.Unlock()
+
+	for _, name := range nodes {
+		if types[name] == "" {
+			d.Nodes = append(d.Nodes, nodeDiagnosis{Node: name, State: "unknown (not started through Start)"})
+			continue
+		}
+		found := false
+		for _, g := range gs {
+			if g.Node != name {
+				continue
+			}
+			_, method := g.NodeType()
+			found = true
+			nd := nodeDiagnosis{Node: name, Func: method, State: g.State}
+			for _, l := range links {
+				from, to := l.Endpoints()
+				s := stats[l.Name()]
+				send := from.Node == name && s.Len == s.Cap && g.State != "chan receive"
+				recv := to.Node == name && s.Len == 0 && g.State != "chan send"
+				if send {
+					nd.Ports = append(nd.Ports, fmt.Sprintf("%s (%s %d/%d)", from.Port, s.Name, s.Len, s.Cap))
+				}
+				if recv {
+					nd.Ports = append(nd.Ports, fmt.Sprintf("%s (%s %d/%d)", to.Port, s.Name, s.Len, s.Cap))
+				}
+			}
+			d.Nodes = append(d.Nodes, nd)
+		}
+		if !found {
+			d.Nodes = append(d.Nodes, nodeDiagnosis{Node: name, State: "finished"})
+		}
+	}
+	return d
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// `holder` takes no sentence until `Release` is closed, and then passes the
+// sentences on as counts.
+type holder struct {
+	Sentence <-chan string
+	Count    chan<- *count
+	Release  chan struct{}
+}
+
+func (h *holder) Process() {
+	go func() {
+		<-h.Release
+		for s := range h.Sentence {
+			h.Count <- &count{"Held", len(s), 1}
+		}
+		close(h.Count)
+	}()
+}
+
+// `watch` starts a watchdog that checks every millisecond and sends its
+// reports to the returned channel.
+func watch(n *network, stall time.Duration, done <-chan struct{}) (<-chan diagnosis, func()) {
+	reports := make(chan diagnosis, 10)
+	stop := n.Watch(watchdogOptions{Interval: time.Millisecond, Stall: stall, Done: done, Report: func(d diagnosis) {
+		reports <- d
+	}})
+	return reports, stop
+}
+
+func TestWatchDeadlock(t *testing.T) {
+	_, restore := captureStdout(t)
+	defer restore()
+	n := newNetwork()
+	s, wc, p := &splitter{}, &wordCounter{}, &printer{}
+	h := &holder{Release: make(chan struct{})}
+	in := newEdge[string](n, "in", 1).Connect("", "In", "splitter", "In")
+	sToWc := newEdge[string](n, "sToWc", 1).Connect("splitter", "Out1", "wordCounter", "Sentence")
+	sToH := newEdge[string](n, "sToH", 1).Connect("splitter", "Out2", "holder", "Sentence")
+	wcToP := newEdge[*count](n, "wcToP", 1).Connect("wordCounter", "Count", "printer", "Line1")
+	hToP := newEdge[*count](n, "hToP", 1).Connect("holder", "Count", "printer", "Line2")
+	done := make(chan struct{})
+	s.In, s.Out1, s.Out2 = in.Out(), sToWc.In(), sToH.In()
+	wc.Sentence, wc.Count = sToWc.Out(), wcToP.In()
+	h.Sentence, h.Count = sToH.Out(), hToP.In()
+	p.Line1, p.Line2, p.Done = wcToP.Out(), hToP.Out(), done
+	for name, node := range map[string]processor{"splitter": s, "wordCounter": wc, "holder": h, "printer": p} {
+		n.Start(name, node)
+	}
+
+	// The edge to the holder holds back the second sentence, the splitter
+	// gets stuck on the third, and the printer's merge waits in
+	// sync.WaitGroup.Wait.
+	in.In() <- "One."
+	in.In() <- "Two."
+	in.In() <- "Three."
+	reports, stop := watch(n, 0, nil)
+	defer stop()
+	var d diagnosis
+	select {
+	case d = <-reports:
+	case <-time.After(time.Second):
+		t.Fatal("the watchdog did not report the deadlock")
+	}
+	if d.Reason != "all node goroutines are blocked, and edge sToH is full" {
+		t.Errorf("got reason %q", d.Reason)
+	}
+	var splitterPorts, mergeWaits bool
+	for _, nd := range d.Nodes {
+		if nd.Node == "splitter" && strings.Join(nd.Ports, ",") == "Out2 (sToH 1/1)" {
+			splitterPorts = true
+		}
+		if nd.Node == "printer" && nd.Func == "merge" && nd.State == "sync.WaitGroup.Wait" {
+			mergeWaits = true
+		}
+		if nd.Node == "holder" && nd.State != "chan receive" {
+			t.Errorf("holder: got state %q", nd.State)
+		}
+	}
+	if !splitterPorts || !mergeWaits {
+		t.Errorf("want the splitter blocked on Out2 and the printer's merge waiting, got\n%s", d)
+	}
+
+	close(h.Release)
+	close(in.In())
+	<-done
+	if err := n.Wait(time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchStall(t *testing.T) {
+	_, restore := captureStdout(t)
+	defer restore()
+	n := newNetwork()
+	in, done := buildCounterNet(n, 2)
+	in <- "Hello."
+	reports, stop := watch(n, 20*time.Millisecond, nil)
+	defer stop()
+
+	// A network that waits for input is not deadlocked, but it stalls.
+	start := time.Now()
+	var d diagnosis
+	select {
+	case d = <-reports:
+	case <-time.After(time.Second):
+		t.Fatal("the watchdog did not report the stall")
+	}
+	if !strings.HasPrefix(d.Reason, "no packet moved for ") || time.Since(start) < 20*time.Millisecond {
+		t.Errorf("got %q after %v", d.Reason, time.Since(start))
+	}
+	for _, nd := range d.Nodes {
+		if nd.Node == "splitter" && strings.Join(nd.Ports, ",") != "In (in 0/2)" {
+			t.Errorf("splitter: got ports %v, want its empty input", nd.Ports)
+		}
+	}
+	// The stall is reported once.
+	select {
+	case d := <-reports:
+		t.Errorf("got a second report:\n%s", d)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(in)
+	<-done
+}
+
+func TestWatchShutdown(t *testing.T) {
+	_, restore := captureStdout(t)
+	defer restore()
+	n := newNetwork()
+	in, done := buildCounterNet(n, 2)
+	reports, stop := watch(n, 10*time.Millisecond, done)
+	defer stop()
+	for _, s := range []string{"Why?", "Because.", "Life is too important to be taken seriously."} {
+		in <- s
+	}
+	close(in)
+	<-done
+	if err := n.Wait(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// Neither the closed input, the time without packets, nor Done count
+	// once the nodes have exited and closed Done.
+	select {
+	case d := <-reports:
+		t.Errorf("got a report after a clean shutdown:\n%s", d)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// `mute` takes counts like `printer`, but exits without closing `Done`.
+type mute struct {
+	Line <-chan *count
+	Done chan<- struct{}
+}
+
+func (m *mute) Process() {
+	go func() {
+		for range m.Line {
+		}
+	}()
+}
+
+func TestWatchDoneOpen(t *testing.T) {
+	n := newNetwork()
+	in := newEdge[*count](n, "in", 1).Connect("", "In", "mute", "Line")
+	done := make(chan struct{})
+	n.Start("mute", &mute{Line: in.Out(), Done: done})
+	reports, stop := watch(n, 0, done)
+	defer stop()
+	in.In() <- &count{"Words", 1, 1}
+	close(in.In())
+	if err := n.Wait(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	var d diagnosis
+	select {
+	case d = <-reports:
+	case <-time.After(time.Second):
+		t.Fatal("the watchdog did not report the open Done")
+	}
+	if d.Reason != "all nodes exited, but Done is still open" {
+		t.Errorf("got reason %q", d.Reason)
+	}
+	if len(d.Nodes) != 1 || d.Nodes[0].State != "finished" {
+		t.Errorf("want the sink finished, got\n%s", d)
+	}
+	// The report comes once.
+	select {
+	case d := <-reports:
+		t.Errorf("got a second report:\n%s", d)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// `websocketSink` lets FBP runtime clients like noflo-ui and Flowhub watch
+// tapped edges. It speaks the little of the FBP network protocol
+// (https://flowbased.github.io/fbp-protocol/) that a runtime needs to
+// report packets: it answers `runtime:getruntime`, and it sends every tapped
+// packet to all connected clients as a `network:data` message like
+//
+//	{"protocol":"network","command":"data","payload":{"id":"lc.Count -> p.Line2",
+//	 "graph":"main","src":{"node":"lc","port":"Count"},"tgt":{"node":"p","port":"Line2"},
+//	 "data":{"tag":"Letters","count":3}}}
+//
+// The clients cannot edit the graph or start and stop the network.
+type websocketSink struct {
+	n     *network
+	graph string
+
+	mu      sync.Mutex
+	clients map[*websocket.Conn]bool
+}
+
+func newWebsocketSink(n *network, graph string) *websocketSink {
+	return &websocketSink{n: n, graph: graph, clients: map[*websocket.Conn]bool{}}
+}
+
+const (
+	// A client that does not take a message within this time is
+	// disconnected, so that it cannot hold up the others.
+	websocketWriteTimeout = time.Second
+	// Clients only send short requests; anything larger ends the
+	// connection.
+	websocketMaxMessage = 64 << 10
+)
+
+// `fbpMessage` is the envelope of all messages of the FBP protocol.
+type fbpMessage struct {
+	Protocol string      `json:"protocol"`
+	Command  string      `json:"command"`
+	Payload  interface{} `json:"payload"`
+}
+
+type fbpPort struct {
+	Node string `json:"node"`
+	Port string `json:"port"`
+}
+
+type fbpData struct {
+	ID    string      `json:"id"`
+	Graph string      `json:"graph"`
+	Src   *fbpPort    `json:"src,omitempty"`
+	Tgt   *fbpPort    `json:"tgt,omitempty"`
+	Data  interface{} `json:"data"`
+}
+
+type fbpRuntime struct {
+	Type         string   `json:"type"`
+	Version      string   `json:"version"`
+	Capabilities []string `json:"capabilities"`
+	Graph        string   `json:"graph"`
+}
+
+func (s *websocketSink) Tap(edge string, at time.Time, packet interface{}) {
+	data := fbpData{ID: edge, Graph: s.graph, Data: packet}
+	if l := s.n.edge(edge); l != nil {
+		from, to := l.Endpoints()
+		data.ID = from.String() + " -> " + to.String()
+		if from.Node != "" {
+			data.Src = &fbpPort{from.Node, from.Port}
+		}
+		if to.Node != "" {
+			data.Tgt = &fbpPort{to.Node, to.Port}
+		}
+	}
+	msg, err := json.Marshal(fbpMessage{"network", "data", data})
+	if err != nil {
+		data.Data = fmt.Sprint(packet)
+		msg, _ = json.Marshal(fbpMessage{"network", "data", data})
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		if err := s.send(c, msg); err != nil {
+			delete(s.clients, c)
+			c.Close()
+		}
+	}
+}
+
+// `send` writes a text message. The caller holds `s.mu`, because a
+// connection allows only one writer at a time.
+func (s *websocketSink) send(c *websocket.Conn, msg []byte) error {
+	c.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+	return c.WriteMessage(websocket.TextMessage, msg)
+}
+
+var upgrader = websocket.Upgrader{Subprotocols: []string{"noflo"}}
+
+// `ServeHTTP` upgrades the request to a WebSocket and adds the client.
+func (s *websocketSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has answered the request already.
+		return
+	}
+	c.SetReadLimit(websocketMaxMessage)
+	s.mu.Lock()
+	s.clients[c] = true
+	s.mu.Unlock()
+	go s.read(c)
+}
+
+// `read` answers the requests of a client until the connection ends, and
+// then removes the client. The WebSocket library answers pings and the
+// closing handshake on its own.
+func (s *websocketSink) read(c *websocket.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+	for {
+		var req struct {
+			Protocol, Command string
+		}
+		if err := c.ReadJSON(&req); err != nil {
+			if _, ok := err.(*json.SyntaxError); ok {
+				continue
+			}
+			return
+		}
+		if req.Protocol != "runtime" || req.Command != "getruntime" {
+			continue
+		}
+		msg, _ := json.Marshal(fbpMessage{"runtime", "runtime", fbpRuntime{
+			Type:         "flow2go",
+			Version:      "0.7",
+			Capabilities: []string{"protocol:runtime", "network:data"},
+			Graph:        s.graph,
+		}})
+		s.mu.Lock()
+		err := s.send(c, msg)
+		s.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// `Close` disconnects all clients.
+func (s *websocketSink) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(websocketWriteTimeout))
+		c.Close()
+		delete(s.clients, c)
+	}
+}
+
+// `ServeWebSocketTaps` starts an HTTP server that accepts FBP protocol
+// clients at `/taps`, and returns the sink to pass to `Tap` for the edges of
+// `n`. `graph` is the name under which the clients see the network. Use an
+// address like "localhost:0" to let the system pick a free port; the
+// returned server's `Addr` contains the actual address.
+func ServeWebSocketTaps(n *network, graph, addr string) (*websocketSink, *http.Server, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot serve taps: %v", err)
+	}
+	s := newWebsocketSink(n, graph)
+	mux := http.NewServeMux()
+	mux.Handle("/taps", s)
+	srv := &http.Server{Addr: l.Addr().String(), Handler: mux}
+	go srv.Serve(l)
+	return s, srv, nil
+}
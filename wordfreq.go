@@ -0,0 +1,245 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A `wordCount` is one entry of a `ranking`.
+type wordCount struct {
+	Word  string
+	Count int
+	// With a limited `wordFrequency.Capacity`, the count is an estimate that
+	// may be too high by up to `Error`.
+	Error int
+}
+
+// A `ranking` holds the most frequent words of a substream, most frequent
+// first. Words with the same count are sorted alphabetically.
+type ranking struct {
+	Substream string
+	Sentences int
+	Words     []wordCount
+	// `Partial` is true for the rankings that `wordFrequency` sends while
+	// the substream is still going on.
+	Partial bool
+}
+
+func (r *ranking) String() string {
+	var b strings.Builder
+	if r.Substream != "" {
+		fmt.Fprintf(&b, "%s: ", r.Substream)
+	}
+	fmt.Fprintf(&b, "top %d words in %d sentences", len(r.Words), r.Sentences)
+	if r.Partial {
+		b.WriteString(" so far")
+	}
+	for i, w := range r.Words {
+		sep := ", "
+		if i == 0 {
+			sep = ": "
+		}
+		fmt.Fprintf(&b, "%s%s (%d)", sep, w.Word, w.Count)
+	}
+	return b.String()
+}
+
+// `wordFrequency` counts how often each word occurs and sends the `K` most
+// frequent words to `Top`:
+//
+//   - after every `Every` sentences, if `Every` is not zero,
+//   - `Interval` after the first sentence that is not in a ranking yet, if
+//     `Interval` is not zero,
+//   - at the end of each substream, and
+//   - at the end of the stream, when `Sentence` is closed.
+//
+// Substreams are runs of consecutive sentences for which `Substream` returns
+// the same key, for example the sentences of one document. Each substream is
+// counted separately. If `Substream` is nil, the whole stream is a single
+// substream.
+//
+// To keep the memory bounded, set `Capacity` to the maximum number of
+// distinct words to keep track of. `wordFrequency` then uses the Space-Saving
+// algorithm: when a new word comes in and all counters are taken, the word
+// replaces the least frequent one and inherits its count. Every word that
+// occurs more than n/`Capacity` times in a substream of n words is certain to
+// be in the ranking, but the counts can be too high. With `Capacity` zero,
+// the counts are exact.
+type wordFrequency struct {
+	Sentence <-chan string
+	Top      chan<- *ranking
+	// The number of words in each ranking. Zero means all words.
+	K int
+	// `Tokenize` splits a sentence into words. Defaults to `wordBoundaries`.
+	Tokenize func(string) []string
+	// `FoldCase` counts "The" and "the" as the same word, in lower case.
+	FoldCase bool
+	// `StopWords` are words not to count, like "the" or "is". If `FoldCase`
+	// is set, the stop words must be in lower case.
+	StopWords map[string]bool
+	Every     int
+	Interval  time.Duration
+	// `Clock` times the `Interval`. Defaults to the wall clock; pass
+	// `network.Clock()` to follow the network's clock.
+	Clock     clock
+	Substream func(sentence string) string
+	Capacity  int
+}
+
+// `stopWords` turns a list of words into a set for `wordFrequency.StopWords`.
+func stopWords(words ...string) map[string]bool {
+	m := make(map[string]bool, len(words))
+	for _, w := range words {
+		m[w] = true
+	}
+	return m
+}
+
+// `englishStopWords` are the most common English words, in lower case.
+var englishStopWords = stopWords(
+	"a", "an", "and", "are", "as", "at", "be", "but", "by", "do", "for",
+	"from", "have", "he", "i", "if", "in", "is", "it", "not", "of", "on",
+	"or", "she", "so", "that", "the", "they", "this", "to", "was", "we",
+	"what", "with", "you",
+)
+
+func (wf *wordFrequency) Process() {
+	fmt.Println("WordFrequency starts.")
+	go func() {
+		tokenize := wf.Tokenize
+		if tokenize == nil {
+			tokenize = wordBoundaries
+		}
+		clk := wf.Clock
+		if clk == nil {
+			clk = realClock{}
+		}
+		counts := newWordCounts(wf.Capacity)
+		key, sentences := "", 0
+		// `due` fires `Interval` after the first sentence that is not in a
+		// ranking yet. It is nil while there is nothing new to send, so
+		// that an idle node does not keep a virtual clock busy.
+		var due <-chan time.Time
+		send := func(partial bool) {
+			wf.Top <- &ranking{Substream: key, Sentences: sentences, Words: counts.top(wf.K), Partial: partial}
+			due = nil
+		}
+		for {
+			var sentence string
+			select {
+			case s, ok := <-wf.Sentence:
+				if !ok {
+					if sentences > 0 {
+						send(false)
+					}
+					fmt.Println("WordFrequency has finished.")
+					close(wf.Top)
+					return
+				}
+				sentence = s
+			case <-due:
+				send(true)
+				continue
+			}
+			if wf.Substream != nil {
+				k := wf.Substream(sentence)
+				if k != key && sentences > 0 {
+					send(false)
+					counts = newWordCounts(wf.Capacity)
+					sentences = 0
+				}
+				key = k
+			}
+			for _, w := range tokenize(sentence) {
+				if wf.FoldCase {
+					w = strings.ToLower(w)
+				}
+				if !wf.StopWords[w] {
+					counts.add(w)
+				}
+			}
+			sentences++
+			if wf.Interval > 0 && due == nil {
+				due = clk.After(wf.Interval)
+			}
+			if wf.Every > 0 && sentences%wf.Every == 0 {
+				send(true)
+			}
+		}
+	}()
+}
+
+// `wordCounts` implements the Space-Saving algorithm. The counters form a
+// min-heap, so that the least frequent word is always at the top.
+type wordCounts struct {
+	capacity int
+	heap     []*wordCount
+	index    map[string]int // word -> position in heap
+}
+
+func newWordCounts(capacity int) *wordCounts {
+	return &wordCounts{capacity: capacity, index: map[string]int{}}
+}
+
+func (c *wordCounts) add(word string) {
+	if i, ok := c.index[word]; ok {
+		c.heap[i].Count++
+		heap.Fix(c, i)
+		return
+	}
+	if c.capacity == 0 || len(c.heap) < c.capacity {
+		heap.Push(c, &wordCount{Word: word, Count: 1})
+		return
+	}
+	min := c.heap[0]
+	delete(c.index, min.Word)
+	*min = wordCount{Word: word, Count: min.Count + 1, Error: min.Count}
+	c.index[word] = 0
+	heap.Fix(c, 0)
+}
+
+// `top` returns the `k` most frequent words, or all words if `k` is zero.
+func (c *wordCounts) top(k int) []wordCount {
+	words := make([]wordCount, len(c.heap))
+	for i, w := range c.heap {
+		words[i] = *w
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if words[i].Count != words[j].Count {
+			return words[i].Count > words[j].Count
+		}
+		return words[i].Word < words[j].Word
+	})
+	if k > 0 && k < len(words) {
+		words = words[:k]
+	}
+	return words
+}
+
+// The methods of `heap.Interface`.
+
+func (c *wordCounts) Len() int { return len(c.heap) }
+
+func (c *wordCounts) Less(i, j int) bool { return c.heap[i].Count < c.heap[j].Count }
+
+func (c *wordCounts) Swap(i, j int) {
+	c.heap[i], c.heap[j] = c.heap[j], c.heap[i]
+	c.index[c.heap[i].Word] = i
+	c.index[c.heap[j].Word] = j
+}
+
+func (c *wordCounts) Push(x interface{}) {
+	w := x.(*wordCount)
+	c.index[w.Word] = len(c.heap)
+	c.heap = append(c.heap, w)
+}
+
+func (c *wordCounts) Pop() interface{} {
+	w := c.heap[len(c.heap)-1]
+	c.heap = c.heap[:len(c.heap)-1]
+	delete(c.index, w.Word)
+	return w
+}
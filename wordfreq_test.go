@@ -0,0 +1,121 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWordFrequency(t *testing.T) {
+	cut := func(s string) string {
+		k, _, _ := strings.Cut(s, ":")
+		return k
+	}
+	tests := []struct {
+		name string
+		node *wordFrequency
+		in   []interface{}
+		want []interface{}
+	}{
+		{"stop words and case folding",
+			&wordFrequency{K: 2, FoldCase: true, StopWords: englishStopWords},
+			[]interface{}{"The cat sat on the mat.", "The Cat ran."},
+			[]interface{}{&ranking{Sentences: 2, Words: []wordCount{{"cat", 2, 0}, {"mat", 1, 0}}}}},
+		{"without case folding",
+			&wordFrequency{K: 2},
+			[]interface{}{"The cat sat on the mat.", "The Cat ran."},
+			[]interface{}{&ranking{Sentences: 2, Words: []wordCount{{"The", 2, 0}, {"Cat", 1, 0}}}}},
+		{"every sentence",
+			&wordFrequency{K: 1, Every: 1},
+			[]interface{}{"a b", "b"},
+			[]interface{}{
+				&ranking{Sentences: 1, Words: []wordCount{{"a", 1, 0}}, Partial: true},
+				&ranking{Sentences: 2, Words: []wordCount{{"b", 2, 0}}, Partial: true},
+				&ranking{Sentences: 2, Words: []wordCount{{"b", 2, 0}}},
+			}},
+		{"substreams",
+			&wordFrequency{K: 1, Tokenize: strings.Fields, Substream: cut, StopWords: stopWords("1:", "2:")},
+			[]interface{}{"1: b a b", "1: a", "2: c"},
+			[]interface{}{
+				&ranking{Substream: "1", Sentences: 2, Words: []wordCount{{"a", 2, 0}}},
+				&ranking{Substream: "2", Sentences: 1, Words: []wordCount{{"c", 1, 0}}},
+			}},
+		{"heavy hitters",
+			&wordFrequency{K: 2, Capacity: 2},
+			[]interface{}{"a a a b c a d"},
+			[]interface{}{&ranking{Sentences: 1, Words: []wordCount{{"a", 4, 0}, {"d", 3, 2}}}}},
+		{"no input", &wordFrequency{}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expect(t, tt.node, ports{"Sentence": tt.in}, ports{"Top": tt.want})
+		})
+	}
+}
+
+func TestWordFrequencyInterval(t *testing.T) {
+	_, restore := captureStdout(t)
+	defer restore()
+	clock := newVirtualClock(virtualEpoch)
+	in := make(chan string)
+	top := make(chan *ranking)
+	(&wordFrequency{Sentence: in, Top: top, K: 1, Interval: time.Minute, Clock: clock}).Process()
+
+	// `next` lets the interval pass and returns the ranking.
+	next := func() *ranking {
+		t.Helper()
+		waitFor(t, "the node waits for the interval", func() bool {
+			_, ok := pendingTimer(clock)
+			return ok
+		})
+		clock.Advance(time.Minute)
+		return <-top
+	}
+	in <- "a b"
+	in <- "b"
+	if r := next(); !reflect.DeepEqual(r, &ranking{Sentences: 2, Words: []wordCount{{"b", 2, 0}}, Partial: true}) {
+		t.Errorf("after the first minute, got %v", r)
+	}
+	// Without new sentences, the node does not wait for the clock.
+	if _, ok := pendingTimer(clock); ok {
+		t.Error("the node waits for the interval without new sentences")
+	}
+	in <- "a a"
+	if r := next(); !reflect.DeepEqual(r, &ranking{Sentences: 3, Words: []wordCount{{"a", 3, 0}}, Partial: true}) {
+		t.Errorf("after the second minute, got %v", r)
+	}
+	close(in)
+	if r := <-top; r.Partial || r.Sentences != 3 {
+		t.Errorf("at the end, got %v", r)
+	}
+	if _, ok := <-top; ok {
+		t.Error("the node did not close Top")
+	}
+}
+
+func TestWordCountsCapacity(t *testing.T) {
+	// "the" occurs in a third of all words, more than 1/capacity, so Space-Saving must find it,
+	// however many rare words come in between.
+	c := newWordCounts(4)
+	for i := 0; i < 100; i++ {
+		c.add("the")
+		c.add(strings.Repeat("x", i%7+1))
+		c.add(strings.Repeat("y", i%13+1))
+	}
+	if len(c.heap) != 4 {
+		t.Errorf("got %d counters, want 4", len(c.heap))
+	}
+	top := c.top(1)
+	if top[0].Word != "the" || top[0].Count < 100 || top[0].Count-top[0].Error > 100 {
+		t.Errorf("got %+v, want the with a count of at least 100", top[0])
+	}
+}
+
+func TestRankingString(t *testing.T) {
+	r := &ranking{Substream: "doc", Sentences: 3, Words: []wordCount{{"cat", 2, 0}, {"mat", 1, 0}}, Partial: true}
+	want := "doc: top 2 words in 3 sentences so far: cat (2), mat (1)"
+	if got := r.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}